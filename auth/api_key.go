@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/tokubai/kinu/logger"
+)
+
+// APIKey is a bearer token scoped to image categories and operations.
+type APIKey struct {
+	KeyName    string      `json:"name"`
+	Key        string      `json:"key"`
+	Categories []string    `json:"categories"`
+	Operations []Operation `json:"operations"`
+}
+
+// APIKeyConfig is the format of the file of KINU_API_KEY_FILE.
+//
+//	{
+//	  "keys": [
+//	    { "name": "web", "key": "...", "categories": ["foods", "users"], "operations": ["upload", "attach"] },
+//	    { "name": "admin", "key": "...", "categories": ["*"], "operations": ["upload", "attach", "delete"] }
+//	  ]
+//	}
+type APIKeyConfig struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+type APIKeyAuthenticator struct {
+	keys []*APIKey
+}
+
+func NewAPIKeyAuthenticator(keys []*APIKey) (*APIKeyAuthenticator, error) {
+	for _, key := range keys {
+		if len(key.KeyName) == 0 || len(key.Key) == 0 {
+			return nil, &ErrInvalidAPIKeyConfig{Message: "api key requires name and key."}
+		}
+		for _, operation := range key.Operations {
+			if operation != OPERATION_UPLOAD && operation != OPERATION_ATTACH && operation != OPERATION_DELETE {
+				return nil, &ErrInvalidAPIKeyConfig{Message: "api key " + key.KeyName + " has unknown operation " + string(operation) + "."}
+			}
+		}
+	}
+	return &APIKeyAuthenticator{keys: keys}, nil
+}
+
+func LoadAPIKeyAuthenticator(path string) (*APIKeyAuthenticator, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, logger.ErrorDebug(err)
+	}
+
+	config := &APIKeyConfig{}
+	err = json.Unmarshal(blob, config)
+	if err != nil {
+		return nil, logger.ErrorDebug(err)
+	}
+
+	return NewAPIKeyAuthenticator(config.Keys)
+}
+
+type ErrInvalidAPIKeyConfig struct {
+	error
+	Message string
+}
+
+func (e *ErrInvalidAPIKeyConfig) Error() string { return e.Message }
+
+// Authenticate finds the api key of `Authorization: Bearer <key>` header.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) == 0 {
+		return nil, ErrCredentialsRequired
+	}
+
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, ErrInvalidCredentials
+	}
+	token := []byte(strings.TrimPrefix(authorization, "Bearer "))
+
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(token, []byte(key.Key)) == 1 {
+			return key, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func (k *APIKey) Name() string { return k.KeyName }
+
+func (k *APIKey) Authorize(operation Operation, category string) error {
+	allowed := false
+	for _, o := range k.Operations {
+		if o == operation {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return &ErrForbidden{Message: "api key " + k.KeyName + " is not allowed to " + string(operation) + "."}
+	}
+
+	if len(category) == 0 {
+		return nil
+	}
+	for _, c := range k.Categories {
+		if c == ANY_CATEGORY || c == category {
+			return nil
+		}
+	}
+	return &ErrForbidden{Message: "api key " + k.KeyName + " is not allowed to " + string(operation) + " " + category + "."}
+}
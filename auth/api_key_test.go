@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	authenticator, err := NewAPIKeyAuthenticator([]*APIKey{
+		{KeyName: "web", Key: "web-key", Categories: []string{"foods"}, Operations: []Operation{OPERATION_UPLOAD, OPERATION_ATTACH}},
+		{KeyName: "admin", Key: "admin-key", Categories: []string{ANY_CATEGORY}, Operations: []Operation{OPERATION_DELETE}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		authorization string
+		operation     Operation
+		category      string
+		authenticated error
+		authorized    bool
+	}{
+		{"Bearer web-key", OPERATION_UPLOAD, "foods", nil, true},
+		{"Bearer web-key", OPERATION_ATTACH, "foods", nil, true},
+		{"Bearer web-key", OPERATION_UPLOAD, "", nil, true},
+		{"Bearer web-key", OPERATION_UPLOAD, "users", nil, false},
+		{"Bearer web-key", OPERATION_DELETE, "foods", nil, false},
+		{"Bearer admin-key", OPERATION_DELETE, "users", nil, true},
+		{"Bearer admin-key", OPERATION_UPLOAD, "users", nil, false},
+		{"", OPERATION_UPLOAD, "foods", ErrCredentialsRequired, false},
+		{"Bearer unknown", OPERATION_UPLOAD, "foods", ErrInvalidCredentials, false},
+		{"Bearer web-key2", OPERATION_UPLOAD, "foods", ErrInvalidCredentials, false},
+		{"Basic d2ViOndlYi1rZXk=", OPERATION_UPLOAD, "foods", ErrInvalidCredentials, false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/upload", nil)
+		if len(c.authorization) != 0 {
+			r.Header.Set("Authorization", c.authorization)
+		}
+
+		principal, err := authenticator.Authenticate(r)
+		if err != c.authenticated {
+			t.Errorf("%q: got %v, want %v", c.authorization, err, c.authenticated)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		err = principal.Authorize(c.operation, c.category)
+		if c.authorized && err != nil {
+			t.Errorf("%q %s %s: %s", c.authorization, c.operation, c.category, err)
+		}
+		if _, ok := err.(*ErrForbidden); !c.authorized && !ok {
+			t.Errorf("%q %s %s: got %#v, want ErrForbidden", c.authorization, c.operation, c.category, err)
+		}
+	}
+}
+
+func TestAPIKeyAuthenticatorInvalidConfig(t *testing.T) {
+	for _, keys := range [][]*APIKey{
+		{{KeyName: "web", Operations: []Operation{OPERATION_UPLOAD}}},
+		{{Key: "key", Operations: []Operation{OPERATION_UPLOAD}}},
+		{{KeyName: "web", Key: "key", Operations: []Operation{"remove"}}},
+	} {
+		if _, err := NewAPIKeyAuthenticator(keys); err == nil {
+			t.Errorf("%+v: created, want error", *keys[0])
+		}
+	}
+}
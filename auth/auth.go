@@ -0,0 +1,45 @@
+// Package auth authenticates requests to the upload api and checks scopes of the credentials.
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Operation string
+
+const (
+	OPERATION_UPLOAD Operation = "upload"
+	OPERATION_ATTACH Operation = "attach"
+	OPERATION_DELETE Operation = "delete"
+)
+
+// ANY_CATEGORY in scopes allows all image categories.
+const ANY_CATEGORY = "*"
+
+var (
+	ErrCredentialsRequired = errors.New("credentials are required.")
+	ErrInvalidCredentials  = errors.New("invalid credentials.")
+)
+
+type ErrForbidden struct {
+	error
+	Message string
+}
+
+func (e *ErrForbidden) Error() string { return e.Message }
+
+// Authenticator identifies the principal of the request,
+// returns ErrCredentialsRequired or ErrInvalidCredentials when it fails.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Principal is an authenticated client.
+type Principal interface {
+	Name() string
+
+	// Authorize returns ErrForbidden when the operation to the category is not allowed,
+	// empty category means that the operation is allowed to any category.
+	Authorize(operation Operation, category string) error
+}
@@ -0,0 +1,179 @@
+// Package cache keeps resized images in memory, so that hot images are not resized over and over.
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// generations are counted in buckets of images, so that they are bounded regardless of the number of images.
+// images of the same bucket are invalidated together, which only drops some entries of other images.
+const GENERATION_BUCKETS = 1024
+
+type Key struct {
+	Category  string
+	Id        string
+	Geometry  string
+	Extension string
+}
+
+type Entry struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+
+	// ContentDPR is the dpr the image is resized with, 0 when dpr is not specified.
+	ContentDPR float64
+}
+
+type Stats struct {
+	MaxBytes  int64  `json:"max_bytes"`
+	Bytes     int64  `json:"bytes"`
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+type resourceKey struct {
+	category string
+	id       string
+}
+
+type lruItem struct {
+	key   Key
+	entry *Entry
+}
+
+// LRU is a least recently used cache bounded by total bytes of bodies.
+type LRU struct {
+	mu sync.Mutex
+
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[Key]*list.Element
+
+	// keys of each image, to invalidate all geometries of the image.
+	resources map[resourceKey]map[Key]struct{}
+
+	// generations are incremented by invalidation, entries resized before it are not stored.
+	generations [GENERATION_BUCKETS]uint64
+
+	hits, misses, evictions uint64
+}
+
+func NewLRU(maxBytes int64) *LRU {
+	return &LRU{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		items:     make(map[Key]*list.Element),
+		resources: make(map[resourceKey]map[Key]struct{}),
+	}
+}
+
+func (c *LRU) Get(key Key) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.ll.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+// Generation returns the generation of the image, which is taken before fetching the image to be cached.
+func (c *LRU) Generation(category string, id string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[generationBucket(category, id)]
+}
+
+// Set stores the entry of the generation and evicts least recently used entries over max bytes,
+// an entry larger than max bytes or of the image invalidated after the generation is not stored.
+func (c *LRU) Set(key Key, entry *Entry, generation uint64) {
+	size := int64(len(entry.Body))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[generationBucket(key.Category, key.Id)] != generation {
+		return
+	}
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, entry: entry})
+	c.bytes += size
+
+	r := resourceKey{category: key.Category, id: key.Id}
+	if c.resources[r] == nil {
+		c.resources[r] = make(map[Key]struct{})
+	}
+	c.resources[r][key] = struct{}{}
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+// InvalidateResource removes all entries of the image, and entries of the image being resized are not stored.
+func (c *LRU) InvalidateResource(category string, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[generationBucket(category, id)]++
+
+	for key := range c.resources[resourceKey{category: category, id: id}] {
+		c.removeElement(c.items[key])
+	}
+}
+
+func (c *LRU) Stats() *Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &Stats{
+		MaxBytes:  c.maxBytes,
+		Bytes:     c.bytes,
+		Entries:   c.ll.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *LRU) removeElement(element *list.Element) {
+	item := element.Value.(*lruItem)
+	c.ll.Remove(element)
+	delete(c.items, item.key)
+	c.bytes -= int64(len(item.entry.Body))
+
+	r := resourceKey{category: item.key.Category, id: item.key.Id}
+	delete(c.resources[r], item.key)
+	if len(c.resources[r]) == 0 {
+		delete(c.resources, r)
+	}
+}
+
+func generationBucket(category string, id string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(category))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	return h.Sum32() % GENERATION_BUCKETS
+}
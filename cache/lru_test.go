@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func testKey(id string, geometry string) Key {
+	return Key{Category: "foods", Id: id, Geometry: geometry, Extension: "jpg"}
+}
+
+func testEntry(size int) *Entry {
+	return &Entry{Body: bytes.Repeat([]byte{1}, size)}
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(100)
+
+	c.Set(testKey("1", "w=100"), testEntry(40), 0)
+	c.Set(testKey("1", "w=200"), testEntry(40), 0)
+	if _, ok := c.Get(testKey("1", "w=100")); !ok {
+		t.Fatal("w=100 is not cached")
+	}
+
+	// w=200 is least recently used.
+	c.Set(testKey("2", "w=100"), testEntry(40), 0)
+	if _, ok := c.Get(testKey("1", "w=200")); ok {
+		t.Error("w=200 is not evicted")
+	}
+	if _, ok := c.Get(testKey("1", "w=100")); !ok {
+		t.Error("w=100 is evicted")
+	}
+
+	// too large entry is not stored and does not evict others.
+	c.Set(testKey("3", "w=100"), testEntry(101), 0)
+	if _, ok := c.Get(testKey("3", "w=100")); ok {
+		t.Error("too large entry is cached")
+	}
+
+	// overwriting does not count bytes twice.
+	c.Set(testKey("2", "w=100"), testEntry(50), 0)
+
+	stats := c.Stats()
+	want := Stats{MaxBytes: 100, Bytes: 90, Entries: 2, Hits: 2, Misses: 2, Evictions: 1}
+	if *stats != want {
+		t.Errorf("got %+v, want %+v", *stats, want)
+	}
+}
+
+func TestLRUInvalidateResource(t *testing.T) {
+	c := NewLRU(1000)
+	c.Set(testKey("1", "w=100"), testEntry(10), 0)
+	c.Set(testKey("1", "w=200"), testEntry(10), 0)
+	c.Set(testKey("10", "w=100"), testEntry(10), 0)
+	c.Set(Key{Category: "users", Id: "1", Geometry: "w=100", Extension: "jpg"}, testEntry(10), 0)
+
+	c.InvalidateResource("foods", "1")
+
+	for _, key := range []Key{testKey("1", "w=100"), testKey("1", "w=200")} {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("%+v is not invalidated", key)
+		}
+	}
+	for _, key := range []Key{testKey("10", "w=100"), {Category: "users", Id: "1", Geometry: "w=100", Extension: "jpg"}} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%+v is invalidated", key)
+		}
+	}
+	if stats := c.Stats(); stats.Bytes != 20 || stats.Entries != 2 {
+		t.Errorf("got %+v after invalidation", *stats)
+	}
+
+	c.InvalidateResource("foods", "unknown")
+}
+
+func TestLRUGeneration(t *testing.T) {
+	c := NewLRU(1000)
+	generation := c.Generation("foods", "1")
+	otherGeneration := c.Generation("foods", "2")
+
+	// the image is replaced while it is resized.
+	c.InvalidateResource("foods", "1")
+	c.Set(testKey("1", "w=100"), testEntry(10), generation)
+	if _, ok := c.Get(testKey("1", "w=100")); ok {
+		t.Error("entry resized before invalidation is cached")
+	}
+
+	c.Set(testKey("1", "w=100"), testEntry(10), c.Generation("foods", "1"))
+	if _, ok := c.Get(testKey("1", "w=100")); !ok {
+		t.Error("entry resized after invalidation is not cached")
+	}
+
+	if generationBucket("foods", "1") != generationBucket("foods", "2") {
+		c.Set(testKey("2", "w=100"), testEntry(10), otherGeneration)
+		if _, ok := c.Get(testKey("2", "w=100")); !ok {
+			t.Error("entry of another image is not cached")
+		}
+	}
+}
+
+func TestLRUConcurrency(t *testing.T) {
+	c := NewLRU(1000)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := testKey(strconv.Itoa(j%20), "w="+strconv.Itoa(i))
+				c.Set(key, testEntry(j%30), c.Generation(key.Category, key.Id))
+				c.Get(key)
+				if j%100 == 0 {
+					c.InvalidateResource("foods", strconv.Itoa(j%20))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Bytes > stats.MaxBytes || stats.Bytes < 0 {
+		t.Errorf("bytes is %d", stats.Bytes)
+	}
+}
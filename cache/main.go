@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+var (
+	// Resized is the cache of resized images, nil when KINU_CACHE_MAX_BYTES is not set.
+	Resized *LRU
+)
+
+func init() {
+	maxBytes := os.Getenv("KINU_CACHE_MAX_BYTES")
+	if len(maxBytes) == 0 {
+		return
+	}
+
+	num, err := strconv.ParseInt(maxBytes, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	Resized = NewLRU(num)
+
+	logger.WithFields(logrus.Fields{
+		"max_bytes": num,
+	}).Info("enable resized image cache")
+}
+
+func IsEnabled() bool {
+	return Resized != nil
+}
+
+func Get(key Key) (*Entry, bool) {
+	if Resized == nil {
+		return nil, false
+	}
+	return Resized.Get(key)
+}
+
+// Generation is taken before fetching the image, and passed to Set with the resized image.
+func Generation(category string, id string) uint64 {
+	if Resized == nil {
+		return 0
+	}
+	return Resized.Generation(category, id)
+}
+
+func Set(key Key, entry *Entry, generation uint64) {
+	if Resized == nil {
+		return
+	}
+	Resized.Set(key, entry, generation)
+}
+
+// InvalidateResource is called when the image is uploaded, attached or deleted through this process,
+// other processes keep their caches.
+func InvalidateResource(category string, id string) {
+	if Resized == nil {
+		return
+	}
+	Resized.InvalidateResource(category, id)
+}
@@ -0,0 +1,55 @@
+// Package client is a helper for applications to build kinu image urls.
+package client
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tokubai/kinu/signature"
+)
+
+type URLBuilder struct {
+	// BaseURL is scheme and host of kinu or CDN, e.g. https://images.example.com
+	BaseURL string
+
+	// Secret signs urls when it is not empty, it must be one of KINU_URL_SIGNATURE_SECRETS.
+	Secret string
+
+	// TTL is the lifetime of signed urls, signed urls never expire when it is 0.
+	TTL time.Duration
+}
+
+func NewURLBuilder(baseURL string, secret string, ttl time.Duration) *URLBuilder {
+	return &URLBuilder{BaseURL: strings.TrimRight(baseURL, "/"), Secret: secret, TTL: ttl}
+}
+
+// ImagePath returns the path of the image, geometry should be in the canonical order, e.g. w=280,h=300,q=85,c=true
+func ImagePath(category string, geometry string, filename string) string {
+	return "/images/" + category + "/" + geometry + "/" + filename
+}
+
+// ImageURL returns the image url which is signed when Secret is set and expires after TTL.
+func (b *URLBuilder) ImageURL(category string, geometry string, filename string) string {
+	var expires time.Time
+	if b.TTL != 0 {
+		expires = time.Now().Add(b.TTL)
+	}
+	return b.ImageURLExpiresAt(category, geometry, filename, expires)
+}
+
+// ImageURLExpiresAt returns the image url signed with the expiry, zero time means no expiry.
+func (b *URLBuilder) ImageURLExpiresAt(category string, geometry string, filename string, expires time.Time) string {
+	path := ImagePath(category, geometry, filename)
+	if len(b.Secret) == 0 {
+		return b.BaseURL + path
+	}
+
+	var e int64
+	if !expires.IsZero() {
+		e = expires.Unix()
+	}
+	query := url.Values{}
+	signature.SignQuery(query, b.Secret, path, e)
+	return b.BaseURL + path + "?" + query.Encode()
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tokubai/kinu/signature"
+)
+
+func TestImageURL(t *testing.T) {
+	unsigned := NewURLBuilder("https://images.example.com/", "", 0)
+	got := unsigned.ImageURL("foods", "w=280,h=300", "1.jpg")
+	if got != "https://images.example.com/images/foods/w=280,h=300/1.jpg" {
+		t.Errorf("unsigned url is %s", got)
+	}
+
+	builder := NewURLBuilder("https://images.example.com", "secret", time.Hour)
+	for _, rawurl := range []string{
+		builder.ImageURL("foods", "w=280,h=300", "1.jpg"),
+		builder.ImageURLExpiresAt("foods", "w=280,h=300", "1.jpg", time.Time{}),
+	} {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != "/images/foods/w=280,h=300/1.jpg" {
+			t.Errorf("%s: path is %s", rawurl, u.Path)
+		}
+		err = signature.Verify([]string{"secret"}, u.Path, u.Query(), time.Now())
+		if err != nil {
+			t.Errorf("%s: %s", rawurl, err)
+		}
+	}
+
+	u, _ := url.Parse(builder.ImageURL("foods", "w=280,h=300", "1.jpg"))
+	err := signature.Verify([]string{"secret"}, u.Path, u.Query(), time.Now().Add(2*time.Hour))
+	if err != signature.ErrSignatureExpired {
+		t.Errorf("got %v after TTL, want ErrSignatureExpired", err)
+	}
+}
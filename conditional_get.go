@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tokubai/kinu/config"
+)
+
+// SetCacheHeaders sets ETag and cache headers configured for the category.
+func SetCacheHeaders(w http.ResponseWriter, category string, etag string, lastModified time.Time) {
+	if len(etag) != 0 {
+		w.Header().Set("ETag", etag)
+	}
+
+	policy := config.CachePolicy(category)
+	if len(policy.CacheControl) != 0 {
+		w.Header().Set("Cache-Control", policy.CacheControl)
+	}
+	if policy.LastModified && !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// IsNotModified evaluates If-None-Match, and If-Modified-Since only when If-None-Match is not sent (RFC 7232).
+func IsNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); len(ifNoneMatch) != 0 {
+		if len(etag) == 0 {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// weak comparison is used for If-None-Match.
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); len(ifModifiedSince) != 0 && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
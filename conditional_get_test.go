@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tokubai/kinu/config"
+)
+
+func TestIsNotModified(t *testing.T) {
+	etag := `"v1-w=100-jpg"`
+	lastModified := time.Date(2021, 7, 1, 12, 0, 0, 500000000, time.UTC)
+	httpDate := func(t time.Time) string { return t.Format(http.TimeFormat) }
+
+	cases := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		etag         string
+		lastModified time.Time
+		want         bool
+	}{
+		{"no conditions", "GET", map[string]string{}, etag, lastModified, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": etag}, etag, lastModified, true},
+		{"other etag", "GET", map[string]string{"If-None-Match": `"v0-w=100-jpg"`}, etag, lastModified, false},
+		{"any etag", "GET", map[string]string{"If-None-Match": "*"}, etag, lastModified, true},
+		{"weak etag", "GET", map[string]string{"If-None-Match": "W/" + etag}, etag, lastModified, true},
+		{"etag in list", "GET", map[string]string{"If-None-Match": `"a", ` + etag + `,"b"`}, etag, lastModified, true},
+		{"etags not in list", "GET", map[string]string{"If-None-Match": `"a", "b"`}, etag, lastModified, false},
+		{"no etag of the image", "GET", map[string]string{"If-None-Match": "*"}, "", lastModified, false},
+		{"head", "HEAD", map[string]string{"If-None-Match": etag}, etag, lastModified, true},
+		{"post", "POST", map[string]string{"If-None-Match": etag}, etag, lastModified, false},
+		{"etag over modified since", "GET", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": httpDate(lastModified)}, etag, lastModified, false},
+		{"etag over not modified since", "GET", map[string]string{"If-None-Match": etag, "If-Modified-Since": httpDate(lastModified.Add(-time.Hour))}, etag, lastModified, true},
+		{"modified since", "GET", map[string]string{"If-Modified-Since": httpDate(lastModified.Add(-time.Second))}, etag, lastModified, false},
+		{"not modified since, truncated to seconds", "GET", map[string]string{"If-Modified-Since": httpDate(lastModified)}, etag, lastModified, true},
+		{"not modified since later", "GET", map[string]string{"If-Modified-Since": httpDate(lastModified.Add(time.Hour))}, etag, lastModified, true},
+		{"invalid date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, etag, lastModified, false},
+		{"no last modified of the image", "GET", map[string]string{"If-Modified-Since": httpDate(lastModified)}, etag, time.Time{}, false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, "/images/foods/w=100/1.jpg", nil)
+		for key, value := range c.header {
+			r.Header.Set(key, value)
+		}
+		if got := IsNotModified(r, c.etag, c.lastModified); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetCacheHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinu-http-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "http_cache.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"default": { "cache_control": "public, max-age=86400", "last_modified": true },
+		"categories": { "users": { "cache_control": "private, max-age=60" } }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.LoadHTTPCacheConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ioutil.WriteFile(path, []byte(`{}`), 0644)
+		config.LoadHTTPCacheConfig(path)
+	}()
+
+	lastModified := time.Date(2021, 7, 1, 21, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+
+	cases := []struct {
+		category     string
+		etag         string
+		lastModified time.Time
+		want         map[string]string
+	}{
+		{"foods", `"v1"`, lastModified, map[string]string{"ETag": `"v1"`, "Cache-Control": "public, max-age=86400", "Last-Modified": "Thu, 01 Jul 2021 12:00:00 GMT"}},
+		{"foods", "", time.Time{}, map[string]string{"ETag": "", "Cache-Control": "public, max-age=86400", "Last-Modified": ""}},
+		{"users", `"v1"`, lastModified, map[string]string{"ETag": `"v1"`, "Cache-Control": "private, max-age=60", "Last-Modified": ""}},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		SetCacheHeaders(w, c.category, c.etag, c.lastModified)
+		for key, value := range c.want {
+			if got := w.Header().Get(key); got != value {
+				t.Errorf("%s %s: got %s %q, want %q", c.category, c.etag, key, got, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+// HTTPCachePolicy is cache headers of image responses.
+type HTTPCachePolicy struct {
+	CacheControl string `json:"cache_control"`
+	LastModified bool   `json:"last_modified"`
+}
+
+// HTTPCacheConfig is the format of the file of KINU_HTTP_CACHE_FILE.
+//
+//	{
+//	  "default": { "cache_control": "public, max-age=86400", "last_modified": true },
+//	  "categories": {
+//	    "users": { "cache_control": "private, max-age=60" }
+//	  }
+//	}
+type HTTPCacheConfig struct {
+	Default    *HTTPCachePolicy            `json:"default"`
+	Categories map[string]*HTTPCachePolicy `json:"categories"`
+}
+
+var (
+	httpCacheConfig = &HTTPCacheConfig{Default: &HTTPCachePolicy{}}
+)
+
+func init() {
+	path := os.Getenv("KINU_HTTP_CACHE_FILE")
+	if len(path) == 0 {
+		return
+	}
+
+	err := LoadHTTPCacheConfig(path)
+	if err != nil {
+		panic(err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"path":          path,
+		"cache_control": httpCacheConfig.Default.CacheControl,
+		"categories":    len(httpCacheConfig.Categories),
+	}).Info("load http cache config")
+}
+
+func LoadHTTPCacheConfig(path string) error {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	config := &HTTPCacheConfig{}
+	err = json.Unmarshal(blob, config)
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	if config.Default == nil {
+		config.Default = &HTTPCachePolicy{}
+	}
+	httpCacheConfig = config
+	return nil
+}
+
+// CachePolicy returns the policy of the category, or the default policy.
+func CachePolicy(category string) *HTTPCachePolicy {
+	if policy, ok := httpCacheConfig.Categories[category]; ok {
+		return policy
+	}
+	return httpCacheConfig.Default
+}
@@ -2,12 +2,30 @@ package config
 
 import (
 	"os"
+	"strings"
+	"time"
 
 	"github.com/tokubai/kinu/logger"
 )
 
 var (
 	BackwardCompatibleMode = false
+
+	// accept geometry keys in any order and redirect to the canonical geometry url.
+	CanonicalGeometryRedirect = false
+
+	// image urls must be signed by one of secrets when it is not empty, the first secret signs redirect urls.
+	URLSignatureSecrets []string
+
+	// requests are canceled after the timeout, 0 means no timeout.
+	RequestTimeout time.Duration
+
+	// storage writes of uploads, deletes and rotations are canceled after the timeout instead of with requests, 0 means no timeout.
+	WriteTimeout = DEFAULT_WRITE_TIMEOUT
+)
+
+const (
+	DEFAULT_WRITE_TIMEOUT = 5 * time.Minute
 )
 
 func init() {
@@ -15,4 +33,30 @@ func init() {
 		BackwardCompatibleMode = true
 		logger.Warn("running backward compaztible mode. this mode is deprecated.")
 	}
+
+	if len(os.Getenv("KINU_CANONICAL_GEOMETRY_REDIRECT")) != 0 {
+		CanonicalGeometryRedirect = true
+	}
+
+	if timeout := os.Getenv("KINU_REQUEST_TIMEOUT"); len(timeout) != 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			panic(err)
+		}
+		RequestTimeout = d
+	}
+
+	if timeout := os.Getenv("KINU_WRITE_TIMEOUT"); len(timeout) != 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			panic(err)
+		}
+		WriteTimeout = d
+	}
+
+	for _, secret := range strings.Split(os.Getenv("KINU_URL_SIGNATURE_SECRETS"), ",") {
+		if len(secret) != 0 {
+			URLSignatureSecrets = append(URLSignatureSecrets, secret)
+		}
+	}
 }
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_READINESS_STORAGE_KEY = "kinu-readiness-check/"
+	DEFAULT_READINESS_TIMEOUT     = 3 * time.Second
+	DEFAULT_SHUTDOWN_DRAIN_DELAY  = 5 * time.Second
+)
+
+var (
+	// ReadinessStorageKey is listed to check the storage is reachable, it does not need to exist.
+	ReadinessStorageKey = DEFAULT_READINESS_STORAGE_KEY
+
+	// ReadinessMaxQueueDepth is the worker queue depth over which kinu is not ready, 0 means the wait buffer size.
+	ReadinessMaxQueueDepth int
+
+	ReadinessTimeout = DEFAULT_READINESS_TIMEOUT
+
+	// ShutdownDrainDelay is waited after /readyz starts failing on graceful shutdown before listeners are closed,
+	// so that load balancers stop sending requests before connections are refused.
+	ShutdownDrainDelay = DEFAULT_SHUTDOWN_DRAIN_DELAY
+)
+
+func init() {
+	if key := os.Getenv("KINU_READINESS_STORAGE_KEY"); len(key) != 0 {
+		ReadinessStorageKey = key
+	}
+
+	if depth := os.Getenv("KINU_READINESS_MAX_QUEUE_DEPTH"); len(depth) != 0 {
+		num, err := strconv.Atoi(depth)
+		if err != nil {
+			panic(err)
+		}
+		ReadinessMaxQueueDepth = num
+	}
+
+	if timeout := os.Getenv("KINU_READINESS_TIMEOUT"); len(timeout) != 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			panic(err)
+		}
+		ReadinessTimeout = d
+	}
+
+	if delay := os.Getenv("KINU_SHUTDOWN_DRAIN_DELAY"); len(delay) != 0 {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			panic(err)
+		}
+		ShutdownDrainDelay = d
+	}
+}
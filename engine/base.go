@@ -2,17 +2,18 @@ package engine
 
 import (
 	"errors"
+	"image/color"
 	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/logger"
-	"gopkg.in/gographics/imagick.v2/imagick"
 )
 
 type ResizeEngine interface {
 	Open() error
 	Close()
 
+	// SetSizeHint is the size of the upright image to decode jpeg scaled down to, before Open.
 	SetSizeHint(width, height int)
 	SetFormat(format string)
 	SetCompressionQuality(quality int)
@@ -20,57 +21,119 @@ type ResizeEngine interface {
 	GetImageHeight() int
 	GetImageWidth() int
 
+	// AutoOrient applies the EXIF orientation, so that the size and coordinates are of the upright image.
+	AutoOrient() error
 	RemoveAlpha() error
 	Resize(width int, height int) error
 	Crop(width int, height int, startX int, startY int) error
+	// Extend places the image at x and y of the canvas of width and height filled with the opaque background.
+	Extend(width int, height int, x int, y int, background color.RGBA) error
+	// Rotate rotates the image clockwise by 90, 180 or 270 degrees, and Flip mirrors it left to right when horizontal,
+	// otherwise top to bottom. the EXIF orientation is applied before them, so that they are relative to the upright image.
+	Rotate(degrees int) error
+	Flip(horizontal bool) error
 	Generate() ([]byte, error)
 }
 
+// DEFAULT_JPEG_QUALITY is used when no quality is requested, same as ImageMagick's default.
+const DEFAULT_JPEG_QUALITY = 92
+
+type engineDriver struct {
+	new        func(image []byte) ResizeEngine
+	initialize func()
+	finalize   func()
+	// formats are encoded by Generate, nil means all formats.
+	formats []string
+}
+
 var (
-	AvailableEngines       = []string{"ImageMagick"}
+	ErrUnsupportedImageFormat = errors.New("unsupported image format.")
+	ErrInvalidImageSize       = errors.New("invalid image size.")
+	ErrInvalidRotation        = errors.New("rotation must be 90, 180 or 270 degrees.")
+
+	// Rotations are degrees accepted by Rotate.
+	Rotations = []int{90, 180, 270}
+)
+
+func IsValidRotation(degrees int) bool {
+	for _, rotation := range Rotations {
+		if rotation == degrees {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	AvailableEngines       = []string{}
 	ErrUnknownResizeEngine = errors.New("specify unknown resize engine.")
 	selectedEngineType     string
+
+	drivers = map[string]*engineDriver{}
 )
 
-func init() {
-	selectedEngineType = os.Getenv("KINU_RESIZE_ENGINE")
-	if len(selectedEngineType) == 0 {
-		panic("must specify KINU_RESIZE_ENGINE system environment.")
-	}
+// register makes a resize engine selectable by KINU_RESIZE_ENGINE.
+// Engines depending on cgo libraries register themselves only when built in.
+func register(engineType string, driver *engineDriver) {
+	drivers[engineType] = driver
+	AvailableEngines = append(AvailableEngines, engineType)
+}
 
-	var isAvailableEngine bool
-	for _, engineType := range AvailableEngines {
-		if selectedEngineType == engineType {
-			isAvailableEngine = true
-		}
+func Select(engineType string) error {
+	if _, ok := drivers[engineType]; !ok {
+		return ErrUnknownResizeEngine
 	}
+	selectedEngineType = engineType
+	return nil
+}
 
-	if !isAvailableEngine {
-		panic("unknown KINU_RESIZE_ENGINE " + selectedEngineType + ".")
-	}
+func SelectedEngineType() string {
+	return selectedEngineType
+}
 
-	logger.WithFields(logrus.Fields{
-		"resize_engine_type": selectedEngineType,
-	}).Info("setup resize engine")
+// CanEncode is false for formats which Generate of the selected engine returns ErrUnsupportedImageFormat.
+func CanEncode(format string) bool {
+	driver, ok := drivers[selectedEngineType]
+	if !ok || driver.formats == nil {
+		return true
+	}
+	for _, f := range driver.formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
 }
 
 func New(image []byte) (ResizeEngine, error) {
-	switch selectedEngineType {
-	case "ImageMagick":
-		return newImageMagickEngine(image), nil
-	default:
+	driver, ok := drivers[selectedEngineType]
+	if !ok {
 		return nil, ErrUnknownResizeEngine
 	}
+	return driver.new(image), nil
 }
 
 func Initialize() {
-	if selectedEngineType == "ImageMagick" {
-		imagick.Initialize()
+	engineType := os.Getenv("KINU_RESIZE_ENGINE")
+	if len(engineType) == 0 {
+		panic("must specify KINU_RESIZE_ENGINE system environment.")
+	}
+
+	if err := Select(engineType); err != nil {
+		panic("unknown KINU_RESIZE_ENGINE " + engineType + ".")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"resize_engine_type": selectedEngineType,
+	}).Info("setup resize engine")
+
+	if driver := drivers[selectedEngineType]; driver.initialize != nil {
+		driver.initialize()
 	}
 }
 
 func Finalize() {
-	if selectedEngineType == "ImageMagick" {
-		imagick.Terminate()
+	if driver, ok := drivers[selectedEngineType]; ok && driver.finalize != nil {
+		driver.finalize()
 	}
 }
@@ -0,0 +1,617 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Conformance suite shared by all resize engines.
+// Every engine registered in AvailableEngines is tested, so engines behind build tags
+// are covered by running `go test -tags vips ./engine` and so on.
+// Fixtures are generated from gradient patterns, expected outputs are the patterns at the result size.
+
+const MIN_PSNR = 28.0
+
+func TestMain(m *testing.M) {
+	for _, driver := range drivers {
+		if driver.initialize != nil {
+			driver.initialize()
+		}
+	}
+
+	code := m.Run()
+
+	for _, driver := range drivers {
+		if driver.finalize != nil {
+			driver.finalize()
+		}
+	}
+	os.Exit(code)
+}
+
+type pattern func(x, y int) color.RGBA
+
+// gradient is red along x and green along y, it is not symmetric so that orientation mistakes are detected.
+func gradient(width, height int) pattern {
+	return func(x, y int) color.RGBA {
+		return color.RGBA{
+			R: uint8((float64(x) + 0.5) / float64(width) * 255),
+			G: uint8((float64(y) + 0.5) / float64(height) * 255),
+			B: 128,
+			A: 255,
+		}
+	}
+}
+
+func shift(p pattern, dx, dy int) pattern {
+	return func(x, y int) color.RGBA { return p(x+dx, y+dy) }
+}
+
+// extended is the pattern of width and height placed at x and y on the background.
+func extended(p pattern, width, height, x, y int, background color.RGBA) pattern {
+	return func(px, py int) color.RGBA {
+		if px < x || py < y || px >= x+width || py >= y+height {
+			return background
+		}
+		return p(px-x, py-y)
+	}
+}
+
+// rotated is the pattern of width and height rotated clockwise by the degrees.
+func rotated(p pattern, width, height, degrees int) pattern {
+	return func(x, y int) color.RGBA {
+		switch degrees {
+		case 90:
+			return p(y, height-1-x)
+		case 180:
+			return p(width-1-x, height-1-y)
+		case 270:
+			return p(width-1-y, x)
+		}
+		return p(x, y)
+	}
+}
+
+// flipped is the pattern of width and height mirrored left to right when horizontal, otherwise top to bottom.
+func flipped(p pattern, width, height int, horizontal bool) pattern {
+	return func(x, y int) color.RGBA {
+		if horizontal {
+			return p(width-1-x, y)
+		}
+		return p(x, height-1-y)
+	}
+}
+
+type fixture struct {
+	blob          []byte
+	width, height int
+}
+
+func renderPattern(width, height int, p pattern) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, p(x, y))
+		}
+	}
+	return img
+}
+
+func jpegFixture(t *testing.T, width, height int) *fixture {
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, renderPattern(width, height, gradient(width, height)), &jpeg.Options{Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{blob: buf.Bytes(), width: width, height: height}
+}
+
+// alphaPngFixture is opaque gradient on the left half and transparent on the right half.
+func alphaPngFixture(t *testing.T, width, height int) *fixture {
+	g := gradient(width, height)
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, g(x, y))
+			} else {
+				img.Set(x, y, color.NRGBA{})
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{blob: buf.Bytes(), width: width, height: height}
+}
+
+// orientedJpegFixture stores the gradient rotated so that it looks upright after applying the EXIF orientation.
+func orientedJpegFixture(t *testing.T, uprightWidth, uprightHeight, orientation int) *fixture {
+	width, height := uprightWidth, uprightHeight
+	if orientation >= 5 {
+		width, height = uprightHeight, uprightWidth
+	}
+
+	upright := gradient(uprightWidth, uprightHeight)
+	raw := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < uprightHeight; y++ {
+		for x := 0; x < uprightWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-x, y
+			case 3:
+				sx, sy = width-1-x, height-1-y
+			case 4:
+				sx, sy = x, height-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, height-1-x
+			case 7:
+				sx, sy = width-1-y, height-1-x
+			case 8:
+				sx, sy = width-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			raw.SetRGBA(sx, sy, upright(x, y))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, raw, &jpeg.Options{Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{blob: withExif(buf.Bytes(), orientation), width: width, height: height}
+}
+
+const FIXTURE_COMMENT = "kinu conformance fixture"
+
+// withExif inserts EXIF APP1 segment with the orientation and a comment segment after SOI.
+func withExif(blob []byte, orientation int) []byte {
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	binary.Write(tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(tiff, binary.BigEndian, uint16(3))
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, uint16(orientation))
+	binary.Write(tiff, binary.BigEndian, uint16(0))
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	exif := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := &bytes.Buffer{}
+	out.Write(blob[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(len(exif)+2))
+	out.Write(exif)
+	out.Write([]byte{0xFF, 0xFE})
+	binary.Write(out, binary.BigEndian, uint16(len(FIXTURE_COMMENT)+2))
+	out.WriteString(FIXTURE_COMMENT)
+	out.Write(blob[2:])
+	return out.Bytes()
+}
+
+func psnr(img image.Image, want pattern) float64 {
+	bounds := img.Bounds()
+	var sum float64
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			w := want(x, y)
+			for _, d := range []float64{float64(r>>8) - float64(w.R), float64(g>>8) - float64(w.G), float64(b>>8) - float64(w.B)} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(bounds.Dx()*bounds.Dy()*3)
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func hasMetadata(blob []byte) bool {
+	return bytes.Contains(blob, []byte("Exif\x00\x00")) || bytes.Contains(blob, []byte(FIXTURE_COMMENT))
+}
+
+type conformanceCase struct {
+	name    string
+	fixture *fixture
+
+	hintWidth, hintHeight int
+	operate               func(e ResizeEngine) error
+	format                string
+	quality               int
+
+	wantFormat            string
+	wantWidth, wantHeight int
+	want                  pattern
+}
+
+func conformanceCases(t *testing.T) []conformanceCase {
+	landscape := jpegFixture(t, 120, 80)
+	portrait := jpegFixture(t, 80, 120)
+	alpha := alphaPngFixture(t, 80, 60)
+
+	cases := []conformanceCase{
+		{
+			name: "open and generate keeps jpeg", fixture: landscape,
+			wantFormat: "jpeg", wantWidth: 120, wantHeight: 80, want: gradient(120, 80),
+		},
+		{
+			name: "resize landscape", fixture: landscape,
+			operate:    func(e ResizeEngine) error { return e.Resize(60, 40) },
+			wantFormat: "jpeg", wantWidth: 60, wantHeight: 40, want: gradient(60, 40),
+		},
+		{
+			name: "resize portrait", fixture: portrait,
+			operate:    func(e ResizeEngine) error { return e.Resize(40, 60) },
+			wantFormat: "jpeg", wantWidth: 40, wantHeight: 60, want: gradient(40, 60),
+		},
+		{
+			name: "resize with size hint", fixture: landscape, hintWidth: 30, hintHeight: 20,
+			operate:    func(e ResizeEngine) error { return e.Resize(30, 20) },
+			wantFormat: "jpeg", wantWidth: 30, wantHeight: 20, want: gradient(30, 20),
+		},
+		{
+			name: "resize then crop", fixture: landscape,
+			operate: func(e ResizeEngine) error {
+				if err := e.Resize(60, 40); err != nil {
+					return err
+				}
+				return e.Crop(40, 40, 10, 0)
+			},
+			wantFormat: "jpeg", wantWidth: 40, wantHeight: 40, want: shift(gradient(60, 40), 10, 0),
+		},
+		{
+			name: "crop then resize", fixture: landscape,
+			operate: func(e ResizeEngine) error {
+				if err := e.Crop(60, 60, 30, 10); err != nil {
+					return err
+				}
+				return e.Resize(30, 30)
+			},
+			wantFormat: "jpeg", wantWidth: 30, wantHeight: 30, want: shift(gradient(60, 40), 15, 5),
+		},
+		{
+			name: "resize then extend", fixture: landscape,
+			operate: func(e ResizeEngine) error {
+				if err := e.Resize(60, 40); err != nil {
+					return err
+				}
+				return e.Extend(60, 60, 0, 10, color.RGBA{R: 0, G: 0, B: 255, A: 255})
+			},
+			wantFormat: "jpeg", wantWidth: 60, wantHeight: 60, want: extended(gradient(60, 40), 60, 40, 0, 10, color.RGBA{R: 0, G: 0, B: 255, A: 255}),
+		},
+		{
+			name: "crop over the image is clipped", fixture: landscape,
+			operate:    func(e ResizeEngine) error { return e.Crop(100, 100, 40, 20) },
+			wantFormat: "jpeg", wantWidth: 80, wantHeight: 60, want: shift(gradient(120, 80), 40, 20),
+		},
+		{
+			name: "convert jpeg to png", fixture: landscape, format: "png",
+			wantFormat: "png", wantWidth: 120, wantHeight: 80, want: gradient(120, 80),
+		},
+		{
+			name: "convert jpeg to webp", fixture: landscape, format: "webp",
+			wantFormat: "webp", wantWidth: 120, wantHeight: 80, want: gradient(120, 80),
+		},
+		{
+			name: "convert jpeg to gif", fixture: landscape, format: "gif",
+			wantFormat: "gif", wantWidth: 120, wantHeight: 80,
+		},
+		{
+			name: "data format is jpeg", fixture: landscape, format: "data",
+			wantFormat: "jpeg", wantWidth: 120, wantHeight: 80, want: gradient(120, 80),
+		},
+		{
+			name: "remove alpha fills white", fixture: alpha, format: "jpg",
+			operate:    func(e ResizeEngine) error { return e.RemoveAlpha() },
+			wantFormat: "jpeg", wantWidth: 80, wantHeight: 60,
+			want: func(x, y int) color.RGBA {
+				if x < 40 {
+					return gradient(80, 60)(x, y)
+				}
+				return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			},
+		},
+		{
+			name: "png keeps png", fixture: alpha,
+			wantFormat: "png", wantWidth: 80, wantHeight: 60,
+		},
+	}
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		cases = append(cases, conformanceCase{
+			name:       "auto orient " + strconv.Itoa(orientation),
+			fixture:    orientedJpegFixture(t, 90, 60, orientation),
+			wantFormat: "jpeg", wantWidth: 90, wantHeight: 60, want: gradient(90, 60),
+		})
+	}
+
+	for _, degrees := range []int{90, 180, 270} {
+		degrees := degrees
+		width, height := 120, 80
+		if degrees != 180 {
+			width, height = 80, 120
+		}
+		cases = append(cases, conformanceCase{
+			name: "rotate " + strconv.Itoa(degrees), fixture: landscape,
+			operate:    func(e ResizeEngine) error { return e.Rotate(degrees) },
+			wantFormat: "jpeg", wantWidth: width, wantHeight: height, want: rotated(gradient(120, 80), 120, 80, degrees),
+		})
+	}
+
+	cases = append(cases,
+		conformanceCase{
+			name: "flip horizontal", fixture: landscape,
+			operate:    func(e ResizeEngine) error { return e.Flip(true) },
+			wantFormat: "jpeg", wantWidth: 120, wantHeight: 80, want: flipped(gradient(120, 80), 120, 80, true),
+		},
+		conformanceCase{
+			name: "flip vertical", fixture: landscape,
+			operate:    func(e ResizeEngine) error { return e.Flip(false) },
+			wantFormat: "jpeg", wantWidth: 120, wantHeight: 80, want: flipped(gradient(120, 80), 120, 80, false),
+		},
+		conformanceCase{
+			name: "rotate then resize", fixture: landscape,
+			operate: func(e ResizeEngine) error {
+				if err := e.Rotate(90); err != nil {
+					return err
+				}
+				if e.GetImageWidth() != 80 || e.GetImageHeight() != 120 {
+					return fmt.Errorf("rotated size is %dx%d", e.GetImageWidth(), e.GetImageHeight())
+				}
+				return e.Resize(40, 60)
+			},
+			wantFormat: "jpeg", wantWidth: 40, wantHeight: 60, want: rotated(gradient(60, 40), 60, 40, 90),
+		},
+	)
+
+	rotatedByExif := orientedJpegFixture(t, 90, 60, 6)
+	cases = append(cases,
+		conformanceCase{
+			name: "auto orient then resize", fixture: rotatedByExif,
+			operate: func(e ResizeEngine) error {
+				if err := e.AutoOrient(); err != nil {
+					return err
+				}
+				if e.GetImageWidth() != 90 || e.GetImageHeight() != 60 {
+					return fmt.Errorf("oriented size is %dx%d", e.GetImageWidth(), e.GetImageHeight())
+				}
+				return e.Resize(45, 30)
+			},
+			wantFormat: "jpeg", wantWidth: 45, wantHeight: 30, want: gradient(45, 30),
+		},
+		conformanceCase{
+			name: "auto orient with size hint", fixture: rotatedByExif, hintWidth: 30, hintHeight: 45,
+			operate: func(e ResizeEngine) error {
+				if err := e.AutoOrient(); err != nil {
+					return err
+				}
+				if e.GetImageWidth() < 30 || e.GetImageHeight() < 45 {
+					return fmt.Errorf("oriented size %dx%d is smaller than the size hint", e.GetImageWidth(), e.GetImageHeight())
+				}
+				return e.Resize(45, 30)
+			},
+			wantFormat: "jpeg", wantWidth: 45, wantHeight: 30, want: gradient(45, 30),
+		},
+		conformanceCase{
+			name: "auto orient twice", fixture: rotatedByExif,
+			operate: func(e ResizeEngine) error {
+				if err := e.AutoOrient(); err != nil {
+					return err
+				}
+				return e.AutoOrient()
+			},
+			wantFormat: "jpeg", wantWidth: 90, wantHeight: 60, want: gradient(90, 60),
+		},
+		conformanceCase{
+			name: "rotate after auto orient", fixture: rotatedByExif,
+			operate:    func(e ResizeEngine) error { return e.Rotate(90) },
+			wantFormat: "jpeg", wantWidth: 60, wantHeight: 90, want: rotated(gradient(90, 60), 90, 60, 90),
+		},
+		conformanceCase{
+			name: "flip after auto orient", fixture: rotatedByExif,
+			operate:    func(e ResizeEngine) error { return e.Flip(true) },
+			wantFormat: "jpeg", wantWidth: 90, wantHeight: 60, want: flipped(gradient(90, 60), 90, 60, true),
+		},
+	)
+
+	return cases
+}
+
+func generate(t *testing.T, c conformanceCase) []byte {
+	e, err := New(c.fixture.blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.hintWidth > 0 && c.hintHeight > 0 {
+		e.SetSizeHint(c.hintWidth, c.hintHeight)
+	}
+
+	err = e.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if c.hintWidth == 0 && (e.GetImageWidth() != c.fixture.width || e.GetImageHeight() != c.fixture.height) {
+		t.Fatalf("opened size is %dx%d, want %dx%d", e.GetImageWidth(), e.GetImageHeight(), c.fixture.width, c.fixture.height)
+	}
+
+	if c.operate != nil {
+		err = c.operate(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(c.format) != 0 {
+		e.SetFormat(c.format)
+	}
+	if c.quality != 0 {
+		e.SetCompressionQuality(c.quality)
+	}
+
+	blob, err := e.Generate()
+	if err == ErrUnsupportedImageFormat {
+		t.Skipf("%s engine does not support %s", selectedEngineType, c.format)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestConformance(t *testing.T) {
+	for _, engineType := range AvailableEngines {
+		t.Run(engineType, func(t *testing.T) {
+			if err := Select(engineType); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, c := range conformanceCases(t) {
+				c := c
+				t.Run(c.name, func(t *testing.T) {
+					blob := generate(t, c)
+
+					img, format, err := image.Decode(bytes.NewReader(blob))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if format != c.wantFormat {
+						t.Errorf("format is %s, want %s", format, c.wantFormat)
+					}
+
+					if img.Bounds().Dx() != c.wantWidth || img.Bounds().Dy() != c.wantHeight {
+						t.Errorf("size is %dx%d, want %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), c.wantWidth, c.wantHeight)
+					}
+
+					if hasMetadata(blob) {
+						t.Errorf("metadata is not stripped")
+					}
+
+					if c.want != nil {
+						if p := psnr(img, c.want); p < MIN_PSNR {
+							t.Errorf("PSNR against expected image is %.2fdB, want over %.2fdB", p, MIN_PSNR)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestConformanceCompressionQuality(t *testing.T) {
+	for _, engineType := range AvailableEngines {
+		t.Run(engineType, func(t *testing.T) {
+			if err := Select(engineType); err != nil {
+				t.Fatal(err)
+			}
+
+			landscape := jpegFixture(t, 120, 80)
+			low := generate(t, conformanceCase{fixture: landscape, format: "jpg", quality: 10})
+			high := generate(t, conformanceCase{fixture: landscape, format: "jpg", quality: 95})
+
+			if len(low) >= len(high) {
+				t.Errorf("quality 10 is %d bytes, quality 95 is %d bytes, want smaller", len(low), len(high))
+			}
+		})
+	}
+}
+
+func TestConformanceInvalidImage(t *testing.T) {
+	for _, engineType := range AvailableEngines {
+		t.Run(engineType, func(t *testing.T) {
+			if err := Select(engineType); err != nil {
+				t.Fatal(err)
+			}
+
+			e, err := New([]byte("not an image"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Open(); err == nil {
+				e.Close()
+				t.Errorf("open invalid image succeeded")
+			}
+		})
+	}
+}
+
+func TestConformanceInvalidRotation(t *testing.T) {
+	landscape := jpegFixture(t, 120, 80)
+	for _, engineType := range AvailableEngines {
+		t.Run(engineType, func(t *testing.T) {
+			if err := Select(engineType); err != nil {
+				t.Fatal(err)
+			}
+
+			e, err := New(landscape.blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+
+			if err := e.Rotate(45); err != ErrInvalidRotation {
+				t.Errorf("rotate 45 degrees: got %v, want ErrInvalidRotation", err)
+			}
+		})
+	}
+}
+
+func TestConformanceCanEncode(t *testing.T) {
+	landscape := jpegFixture(t, 120, 80)
+	for _, engineType := range AvailableEngines {
+		t.Run(engineType, func(t *testing.T) {
+			if err := Select(engineType); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, format := range []string{"jpg", "jpeg", "png", "webp", "gif"} {
+				e, err := New(landscape.blob)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = e.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				e.SetFormat(format)
+				_, err = e.Generate()
+				e.Close()
+
+				if CanEncode(format) != (err != ErrUnsupportedImageFormat) {
+					t.Errorf("%s: CanEncode is %v, Generate returned %v", format, CanEncode(format), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package engine
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/tokubai/kinu/exif"
+	"github.com/tokubai/kinu/logger"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+func init() {
+	register("Go", &engineDriver{
+		new:     func(image []byte) ResizeEngine { return newGoEngine(image) },
+		formats: []string{"jpeg", "jpg", "png", "gif", "bmp", "tiff"},
+	})
+}
+
+// GoEngine is a pure Go resize engine using the standard image codecs,
+// it requires no cgo so that kinu can be built as a static binary.
+type GoEngine struct {
+	ResizeEngine
+
+	img               *image.RGBA
+	orientation       int
+	sourceFormat      string
+	format            string
+	quality           int
+	originalImageBlob []byte
+}
+
+func newGoEngine(image []byte) (e *GoEngine) {
+	return &GoEngine{originalImageBlob: image}
+}
+
+// jpeg decoder of the standard library can not scale on decoding, so the size hint is ignored.
+func (e *GoEngine) SetSizeHint(width int, height int) {
+}
+
+func (e *GoEngine) SetFormat(format string) {
+	if format == "data" {
+		e.format = "jpeg"
+	} else {
+		e.format = format
+	}
+}
+
+func (e *GoEngine) SetCompressionQuality(quality int) {
+	e.quality = quality
+}
+
+func (e *GoEngine) Open() error {
+	src, format, err := image.Decode(bytes.NewReader(e.originalImageBlob))
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	bounds := src.Bounds()
+	e.img = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(e.img, e.img.Bounds(), src, bounds.Min, draw.Src)
+
+	e.sourceFormat = format
+	if format == "jpeg" {
+		e.orientation = exif.Orientation(e.originalImageBlob)
+	}
+	return nil
+}
+
+func (e *GoEngine) Close() {
+	e.img = nil
+}
+
+func (e *GoEngine) GetImageHeight() int {
+	return e.img.Bounds().Dy()
+}
+
+func (e *GoEngine) GetImageWidth() int {
+	return e.img.Bounds().Dx()
+}
+
+func (e *GoEngine) RemoveAlpha() error {
+	dst := image.NewRGBA(e.img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), e.img, e.img.Bounds().Min, draw.Over)
+	e.img = dst
+	return nil
+}
+
+func (e *GoEngine) Resize(width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImageSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), e.img, e.img.Bounds(), draw.Src, nil)
+	e.img = dst
+	return nil
+}
+
+func (e *GoEngine) Crop(width int, height int, startX int, startY int) error {
+	rect := image.Rect(startX, startY, startX+width, startY+height).Intersect(e.img.Bounds())
+	if rect.Empty() {
+		return ErrInvalidImageSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), e.img, rect.Min, draw.Src)
+	e.img = dst
+	return nil
+}
+
+// Extend composites the image over the background, transparent pixels are flattened.
+func (e *GoEngine) Extend(width int, height int, x int, y int, background color.RGBA) error {
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImageSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, e.img.Bounds().Add(image.Pt(x, y)), e.img, e.img.Bounds().Min, draw.Over)
+	e.img = dst
+	return nil
+}
+
+// Rotate transforms the image the same as the EXIF orientation of the rotation.
+func (e *GoEngine) Rotate(degrees int) error {
+	if !IsValidRotation(degrees) {
+		return ErrInvalidRotation
+	}
+	e.AutoOrient()
+	e.img = orient(e.img, map[int]int{90: 6, 180: 3, 270: 8}[degrees])
+	return nil
+}
+
+func (e *GoEngine) Flip(horizontal bool) error {
+	e.AutoOrient()
+	if horizontal {
+		e.img = orient(e.img, 2)
+	} else {
+		e.img = orient(e.img, 4)
+	}
+	return nil
+}
+
+func (e *GoEngine) AutoOrient() error {
+	if e.orientation > 1 {
+		e.img = orient(e.img, e.orientation)
+		e.orientation = 1
+	}
+	return nil
+}
+
+func (e *GoEngine) Generate() ([]byte, error) {
+	e.AutoOrient()
+
+	format := e.format
+	if len(format) == 0 {
+		format = e.sourceFormat
+	}
+
+	// encoders of the standard library do not write any metadata, nothing to strip.
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg", "jpg":
+		quality := e.quality
+		if quality == 0 {
+			quality = DEFAULT_JPEG_QUALITY
+		}
+		err = jpeg.Encode(buf, e.img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(buf, e.img)
+	case "gif":
+		err = gif.Encode(buf, e.img, nil)
+	case "bmp":
+		err = bmp.Encode(buf, e.img)
+	case "tiff":
+		err = tiff.Encode(buf, e.img, nil)
+	default:
+		return nil, ErrUnsupportedImageFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// orient transforms img into top-left orientation from the given EXIF orientation.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	var dst *image.RGBA
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+
+	dw, dh := dst.Bounds().Dx(), dst.Bounds().Dy()
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 270 clockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			si := img.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return dst
+}
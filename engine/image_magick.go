@@ -1,8 +1,13 @@
+//go:build cgo
+// +build cgo
+
 package engine
 
 import (
 	"fmt"
+	"image/color"
 
+	"github.com/tokubai/kinu/exif"
 	"github.com/tokubai/kinu/logger"
 	"gopkg.in/gographics/imagick.v2/imagick"
 )
@@ -17,6 +22,14 @@ type ImageMagickEngine struct {
 	heightSizeHint, widthSizeHint int
 }
 
+func init() {
+	register("ImageMagick", &engineDriver{
+		new:        func(image []byte) ResizeEngine { return newImageMagickEngine(image) },
+		initialize: imagick.Initialize,
+		finalize:   imagick.Terminate,
+	})
+}
+
 func newImageMagickEngine(image []byte) (e *ImageMagickEngine) {
 	return &ImageMagickEngine{originalImageBlob: image}
 }
@@ -41,7 +54,12 @@ func (e *ImageMagickEngine) SetCompressionQuality(quality int) {
 func (e *ImageMagickEngine) Open() error {
 	e.mw = imagick.NewMagickWand()
 	if e.heightSizeHint > 0 && e.widthSizeHint > 0 {
-		e.mw.SetOption("jpeg:size", fmt.Sprintf("%dx%d", e.heightSizeHint, e.widthSizeHint))
+		// the size hint is of the upright image, jpeg is decoded before the orientation is applied.
+		heightSizeHint, widthSizeHint := e.heightSizeHint, e.widthSizeHint
+		if exif.Orientation(e.originalImageBlob) >= 5 {
+			heightSizeHint, widthSizeHint = widthSizeHint, heightSizeHint
+		}
+		e.mw.SetOption("jpeg:size", fmt.Sprintf("%dx%d", heightSizeHint, widthSizeHint))
 	}
 	err := e.mw.ReadImageBlob(e.originalImageBlob)
 	if err != nil {
@@ -78,15 +96,61 @@ func (e *ImageMagickEngine) Crop(width int, height int, startX int, startY int)
 	return e.mw.CropImage(uint(width), uint(height), startX, startY)
 }
 
-func (e *ImageMagickEngine) Generate() ([]byte, error) {
+// Extend composites the image over the background, the offset of the extent is negative to move the image.
+func (e *ImageMagickEngine) Extend(width int, height int, x int, y int, background color.RGBA) error {
+	pw := imagick.NewPixelWand()
+	defer pw.Destroy()
+	pw.SetColor(fmt.Sprintf("rgb(%d,%d,%d)", background.R, background.G, background.B))
+
+	err := e.mw.SetImageBackgroundColor(pw)
+	if err != nil {
+		return err
+	}
+	return e.mw.ExtentImage(uint(width), uint(height), -x, -y)
+}
+
+func (e *ImageMagickEngine) Rotate(degrees int) error {
+	if !IsValidRotation(degrees) {
+		return ErrInvalidRotation
+	}
+	err := e.AutoOrient()
+	if err != nil {
+		return err
+	}
+
+	// the background is not painted by rotations of right angles.
+	pw := imagick.NewPixelWand()
+	defer pw.Destroy()
+	return e.mw.RotateImage(pw, float64(degrees))
+}
+
+// Flip uses FlopImage for horizontal, FlipImage of ImageMagick mirrors top to bottom.
+func (e *ImageMagickEngine) Flip(horizontal bool) error {
+	err := e.AutoOrient()
+	if err != nil {
+		return err
+	}
+	if horizontal {
+		return e.mw.FlopImage()
+	}
+	return e.mw.FlipImage()
+}
+
+// AutoOrient resets the orientation to top left, so it is applied only once.
+func (e *ImageMagickEngine) AutoOrient() error {
 	orientation := e.mw.GetImageOrientation()
 	if orientation != imagick.ORIENTATION_UNDEFINED && orientation != imagick.ORIENTATION_TOP_LEFT {
-		err := e.mw.AutoOrientImage()
-		if err != nil {
-			return nil, err
-		}
+		return e.mw.AutoOrientImage()
+	}
+	return nil
+}
+
+func (e *ImageMagickEngine) Generate() ([]byte, error) {
+	err := e.AutoOrient()
+	if err != nil {
+		return nil, err
 	}
-	err := e.mw.StripImage()
+	err = e.mw.StripImage()
 	if err != nil {
 		return nil, err
 	}
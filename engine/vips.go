@@ -0,0 +1,252 @@
+//go:build vips
+// +build vips
+
+package engine
+
+import (
+	"image/color"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/tokubai/kinu/logger"
+)
+
+func init() {
+	register("Vips", &engineDriver{
+		new: func(image []byte) ResizeEngine { return newVipsEngine(image) },
+		initialize: func() {
+			vips.LoggingSettings(nil, vips.LogLevelWarning)
+			// kinu runs resizes concurrently per request, operation cache and threads of libvips only costs memory.
+			vips.Startup(&vips.Config{ConcurrencyLevel: 1, MaxCacheFiles: 0, MaxCacheMem: 0, MaxCacheSize: 0})
+		},
+		finalize: vips.Shutdown,
+		formats:  []string{"jpeg", "jpg", "png", "webp", "gif"},
+	})
+}
+
+// VipsEngine is a libvips backed resize engine. libvips decodes pixels on demand and jpeg
+// is shrunk on load by the size hint, so it uses much less memory than ImageMagick.
+type VipsEngine struct {
+	ResizeEngine
+
+	img               *vips.ImageRef
+	orientation       int
+	format            string
+	quality           int
+	originalImageBlob []byte
+
+	heightSizeHint, widthSizeHint int
+}
+
+func newVipsEngine(image []byte) (e *VipsEngine) {
+	return &VipsEngine{originalImageBlob: image}
+}
+
+func (e *VipsEngine) SetSizeHint(width int, height int) {
+	e.heightSizeHint = height
+	e.widthSizeHint = width
+}
+
+func (e *VipsEngine) SetFormat(format string) {
+	if format == "data" {
+		e.format = "jpeg"
+	} else {
+		e.format = format
+	}
+}
+
+func (e *VipsEngine) SetCompressionQuality(quality int) {
+	e.quality = quality
+}
+
+func (e *VipsEngine) Open() error {
+	// loading only reads the header, pixels are not decoded until Generate.
+	img, err := vips.LoadImageFromBuffer(e.originalImageBlob, vips.NewImportParams())
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	if shrink := e.jpegShrinkFactor(img); shrink > 1 {
+		img.Close()
+		params := vips.NewImportParams()
+		params.JpegShrinkFactor.Set(shrink)
+		img, err = vips.LoadImageFromBuffer(e.originalImageBlob, params)
+		if err != nil {
+			return logger.ErrorDebug(err)
+		}
+	}
+
+	e.img = img
+	e.orientation = img.GetOrientation()
+	return nil
+}
+
+// jpegShrinkFactor returns the largest jpeg shrink factor keeping the image larger than the size hint,
+// the same as jpeg:size option of ImageMagick.
+func (e *VipsEngine) jpegShrinkFactor(img *vips.ImageRef) int {
+	if img.Format() != vips.ImageTypeJPEG || e.heightSizeHint <= 0 || e.widthSizeHint <= 0 {
+		return 1
+	}
+
+	// the size hint is of the upright image, jpeg is shrunk before the orientation is applied.
+	widthSizeHint, heightSizeHint := e.widthSizeHint, e.heightSizeHint
+	if img.GetOrientation() >= 5 {
+		widthSizeHint, heightSizeHint = heightSizeHint, widthSizeHint
+	}
+
+	for _, shrink := range []int{8, 4, 2} {
+		if img.Width()/shrink >= widthSizeHint && img.Height()/shrink >= heightSizeHint {
+			return shrink
+		}
+	}
+	return 1
+}
+
+func (e *VipsEngine) Close() {
+	if e.img != nil {
+		e.img.Close()
+	}
+}
+
+func (e *VipsEngine) GetImageHeight() int {
+	return e.img.Height()
+}
+
+func (e *VipsEngine) GetImageWidth() int {
+	return e.img.Width()
+}
+
+func (e *VipsEngine) RemoveAlpha() error {
+	if !e.img.HasAlpha() {
+		return nil
+	}
+	return e.img.Flatten(&vips.Color{R: 255, G: 255, B: 255})
+}
+
+func (e *VipsEngine) Resize(width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImageSize
+	}
+	hScale := float64(width) / float64(e.img.Width())
+	vScale := float64(height) / float64(e.img.Height())
+	return e.img.ResizeWithVScale(hScale, vScale, vips.KernelLanczos3)
+}
+
+func (e *VipsEngine) Crop(width int, height int, startX int, startY int) error {
+	// ImageMagick crops the region overlapping with the image, libvips fails when the region is out of the image.
+	if startX < 0 {
+		width, startX = width+startX, 0
+	}
+	if startY < 0 {
+		height, startY = height+startY, 0
+	}
+	if startX+width > e.img.Width() {
+		width = e.img.Width() - startX
+	}
+	if startY+height > e.img.Height() {
+		height = e.img.Height() - startY
+	}
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImageSize
+	}
+	return e.img.ExtractArea(startX, startY, width, height)
+}
+
+// Extend flattens transparent pixels onto the background like the other engines, libvips only embeds the image.
+func (e *VipsEngine) Extend(width int, height int, x int, y int, background color.RGBA) error {
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImageSize
+	}
+	c := &vips.Color{R: background.R, G: background.G, B: background.B}
+	if e.img.HasAlpha() {
+		err := e.img.Flatten(c)
+		if err != nil {
+			return err
+		}
+	}
+	return e.img.EmbedBackground(x, y, width, height, c)
+}
+
+func (e *VipsEngine) Rotate(degrees int) error {
+	if !IsValidRotation(degrees) {
+		return ErrInvalidRotation
+	}
+	err := e.AutoOrient()
+	if err != nil {
+		return err
+	}
+	return e.img.Rotate(map[int]vips.Angle{90: vips.Angle90, 180: vips.Angle180, 270: vips.Angle270}[degrees])
+}
+
+func (e *VipsEngine) Flip(horizontal bool) error {
+	err := e.AutoOrient()
+	if err != nil {
+		return err
+	}
+	if horizontal {
+		return e.img.Flip(vips.DirectionHorizontal)
+	}
+	return e.img.Flip(vips.DirectionVertical)
+}
+
+func (e *VipsEngine) AutoOrient() error {
+	if e.orientation > 1 {
+		err := e.img.AutoRotate()
+		if err != nil {
+			return err
+		}
+		e.orientation = 1
+	}
+	return nil
+}
+
+func (e *VipsEngine) Generate() ([]byte, error) {
+	err := e.AutoOrient()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.img.RemoveMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	format := e.format
+	if len(format) == 0 {
+		format = vips.ImageTypes[e.img.Format()]
+	}
+
+	var blob []byte
+	switch format {
+	case "jpeg", "jpg":
+		params := vips.NewJpegExportParams()
+		params.StripMetadata = true
+		params.Interlace = false
+		params.Quality = DEFAULT_JPEG_QUALITY
+		if e.quality != 0 {
+			params.Quality = e.quality
+		}
+		blob, _, err = e.img.ExportJpeg(params)
+	case "png":
+		params := vips.NewPngExportParams()
+		params.StripMetadata = true
+		blob, _, err = e.img.ExportPng(params)
+	case "webp":
+		params := vips.NewWebpExportParams()
+		params.StripMetadata = true
+		if e.quality != 0 {
+			params.Quality = e.quality
+		}
+		blob, _, err = e.img.ExportWebp(params)
+	case "gif":
+		params := vips.NewGifExportParams()
+		params.StripMetadata = true
+		blob, _, err = e.img.ExportGIF(params)
+	default:
+		return nil, ErrUnsupportedImageFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, nil
+}
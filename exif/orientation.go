@@ -0,0 +1,73 @@
+// Package exif reads the EXIF orientation of jpeg without decoding the image, it is shared by
+// resize engines and resources storing the size of the image displayed upright.
+package exif
+
+import (
+	"encoding/binary"
+)
+
+// Orientation returns the orientation tag of the EXIF APP1 segment in jpeg, or 1 when not found.
+func Orientation(blob []byte) int {
+	if len(blob) < 4 || blob[0] != 0xFF || blob[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(blob) {
+		if blob[pos] != 0xFF {
+			return 1
+		}
+		marker := blob[pos+1]
+		// start of scan, no more metadata segments.
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(blob[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(blob) {
+			return 1
+		}
+		segment := blob[pos+4 : pos+2+length]
+		if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(header []byte) int {
+	if len(header) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(header[4:8]))
+	if ifd+2 > len(header) {
+		return 1
+	}
+
+	entries := int(order.Uint16(header[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(header) {
+			return 1
+		}
+		if order.Uint16(header[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(header[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
@@ -0,0 +1,35 @@
+package exif
+
+import (
+	"testing"
+)
+
+func TestOrientation(t *testing.T) {
+	// SOI, APP1 of EXIF with the big endian TIFF header and one IFD entry of the orientation.
+	exif := []byte{
+		0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x22,
+		'E', 'x', 'i', 'f', 0x00, 0x00,
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xDA,
+	}
+
+	cases := []struct {
+		name string
+		blob []byte
+		want int
+	}{
+		{"exif", exif, 6},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"jpeg without exif", []byte{0xFF, 0xD8, 0xFF, 0xDA}, 1},
+		{"truncated", exif[:20], 1},
+		{"empty", nil, 1},
+	}
+
+	for _, c := range cases {
+		if got := Orientation(c.blob); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
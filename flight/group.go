@@ -0,0 +1,92 @@
+// Package flight coalesces identical calls in flight into one call, like singleflight,
+// and cancels the call when all callers are gone.
+package flight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	cancel  context.CancelFunc
+	waiters int
+}
+
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// valueContext has values of the first caller, e.g. the request id in logs, without its cancellation.
+type valueContext struct {
+	context.Context
+}
+
+func (valueContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueContext) Done() <-chan struct{}       { return nil }
+func (valueContext) Err() error                  { return nil }
+
+// Do calls fn once for callers of the same key in flight, and returns its result to all of them.
+// fn runs with a context which has the deadline of the first caller and is canceled when all callers
+// are canceled, a canceled caller returns the error of its own context. shared reports whether
+// the caller joined the call of another caller.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	c, shared := g.calls[key]
+	if shared {
+		c.waiters++
+	} else {
+		var callCtx context.Context
+		var cancel context.CancelFunc
+		if deadline, ok := ctx.Deadline(); ok {
+			callCtx, cancel = context.WithDeadline(valueContext{ctx}, deadline)
+		} else {
+			callCtx, cancel = context.WithCancel(valueContext{ctx})
+		}
+		c = &call{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.calls[key] = c
+
+		go func() {
+			c.val, c.err = fn(callCtx)
+
+			g.mu.Lock()
+			g.forget(key, c)
+			g.mu.Unlock()
+
+			cancel()
+			close(c.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// new callers start another call instead of joining the canceled one.
+			g.forget(key, c)
+			c.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), shared
+	}
+}
+
+// forget must be called with the lock.
+func (g *Group) forget(key string, c *call) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
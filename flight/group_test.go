@@ -0,0 +1,123 @@
+package flight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoShared(t *testing.T) {
+	g := &Group{}
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err, _ := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn is called %d times", calls)
+	}
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("result %d is %v", i, v)
+		}
+	}
+}
+
+func TestDoCanceledByAllCallers(t *testing.T) {
+	g := &Group{}
+	canceled := make(chan struct{})
+	started := make(chan struct{})
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err, _ := g.Do(ctx1, "key", func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		})
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err, shared := g.Do(ctx2, "key", func(ctx context.Context) (interface{}, error) {
+			t.Error("second caller must join the call in flight")
+			return nil, nil
+		})
+		if !shared {
+			t.Error("second caller is not shared")
+		}
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("first caller got %v", err)
+	}
+	select {
+	case <-canceled:
+		t.Fatal("call is canceled while the second caller waits")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("second caller got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("call is not canceled after all callers are canceled")
+	}
+
+	// a new caller starts a new call.
+	v, err, shared := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "new", nil
+	})
+	if v != "new" || err != nil || shared {
+		t.Errorf("got %v, %v, shared %v", v, err, shared)
+	}
+}
+
+func TestDoDeadline(t *testing.T) {
+	g := &Group{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err, _ := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("deadline of the caller is not set")
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v", err)
+	}
+}
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/aws/aws-sdk-go v1.38.67
 	github.com/certifi/gocertifi v0.0.0-20210507211836-431795d63e8d // indirect
+	github.com/davidbyttow/govips/v2 v2.9.0
 	github.com/doloopwhile/logrusltsv v0.0.0-20210101134554-eeb21fde2073
 	github.com/getsentry/raven-go v0.2.0
 	github.com/julienschmidt/httprouter v1.3.0
@@ -12,5 +13,6 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/vincent-petithory/dataurl v0.0.0-20191104211930-d1553a71de50
 	github.com/zenazn/goji v1.0.1
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
 	gopkg.in/gographics/imagick.v2 v2.6.0
 )
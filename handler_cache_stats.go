@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/cache"
+)
+
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !cache.IsEnabled() {
+		RespondBadRequest(w, "resized image cache is not enabled")
+		return
+	}
+
+	js, err := json.Marshal(cache.Resized.Stats())
+	if err != nil {
+		RespondInternalServerError(w, r, err)
+		return
+	}
+
+	RespondJson(w, js)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/cache"
+	"github.com/tokubai/kinu/resource"
+	"github.com/tokubai/kinu/storage"
+)
+
+func DeleteImageHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	imageType := ps.ByName("type")
+	if len(imageType) == 0 {
+		RespondBadRequest(w, "required image type.")
+		return
+	}
+
+	imageId := ps.ByName("id")
+	if len(imageId) == 0 {
+		RespondBadRequest(w, "required id.")
+		return
+	}
+
+	accessLogOf(r).SetImage(imageType, imageId)
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err := resource.New(imageType, imageId).Delete(ctx)
+	// the image may be partially deleted even on errors.
+	cache.InvalidateResource(imageType, imageId)
+	if err != nil {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if err == storage.ErrImageNotFound {
+			RespondNotFound(w)
+		} else {
+			RespondInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	RespondNoContent(w)
+}
@@ -1,24 +1,51 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/cache"
+	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/engine"
+	"github.com/tokubai/kinu/flight"
 	"github.com/tokubai/kinu/logger"
 	"github.com/tokubai/kinu/resizer"
 	"github.com/tokubai/kinu/resource"
+	"github.com/tokubai/kinu/signature"
 	"github.com/tokubai/kinu/storage"
 )
 
+var (
+	// resizeGroup coalesces identical resize requests in flight into one resize.
+	resizeGroup flight.Group
+)
+
 func GetImageHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// image info is signed like images, it tells which ids exist.
+	if len(config.URLSignatureSecrets) != 0 {
+		err := signature.Verify(config.URLSignatureSecrets, r.URL.Path, r.URL.Query(), time.Now())
+		if err != nil {
+			RespondForbidden(w, err.Error())
+			return
+		}
+	}
+
+	if ps.ByName("filename") == IMAGE_INFO_FILENAME {
+		ImageInfoHandler(w, r, ps)
+		return
+	}
+
 	err := SetContentType(w, ps.ByName("filename"))
 	if err != nil {
 		if err == ErrInvalidImageExt {
 			RespondBadRequest(w, err.Error())
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 		return
 	}
@@ -30,63 +57,220 @@ func GetImageHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		} else if _, ok := err.(*resizer.ErrInvalidGeometryOrderRequest); ok {
 			RespondNotFound(w)
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 		return
 	}
 
+	// e.g. webp of the Go resize engine, rejected before the image is fetched.
+	if request.NeedsResize() && !engine.CanEncode(request.Extension) {
+		RespondBadRequest(w, request.Extension+" is not supported by the "+engine.SelectedEngineType()+" resize engine.")
+		return
+	}
+
+	if config.CanonicalGeometryRedirect && !request.IsCanonical(ps) {
+		location := request.CanonicalPath(ps)
+		query := r.URL.Query()
+		if len(config.URLSignatureSecrets) != 0 {
+			// the signature is verified, so re-sign the canonical path with the same expiry.
+			expires, _ := signature.Expires(query)
+			signature.SignQuery(query, config.URLSignatureSecrets[0], location, expires)
+		}
+		if len(query) != 0 {
+			location += "?" + query.Encode()
+		}
+		RespondMovedPermanently(w, r, location)
+		return
+	}
+
+	cacheKey := cache.Key{Category: request.Category, Id: request.Id, Geometry: request.Geometry.Canonical(), Extension: request.Extension}
+
+	record := accessLogOf(r)
+	record.SetImage(request.Category, request.Id)
+	record.Geometry = request.CanonicalGeometry()
+
+	if entry, ok := cache.Get(cacheKey); ok {
+		record.CacheStatus = CACHE_STATUS_HIT
+		SetCacheHeaders(w, request.Category, entry.ETag, entry.LastModified)
+		setContentDPR(w, entry.ContentDPR)
+		if IsNotModified(r, entry.ETag, entry.LastModified) {
+			RespondNotModified(w)
+			return
+		}
+		respondResizedImage(w, r, request, entry.Body)
+		return
+	}
+
+	// taken before fetching, so that images replaced while they are resized are not cached.
+	generation := cache.Generation(request.Category, request.Id)
+
 	targetResource := resource.New(request.Category, request.Id)
 
 	imageFetchStartTime := time.Now()
-	image, err := targetResource.Fetch(request.Geometry)
+	image, err := targetResource.Fetch(r.Context(), request.Geometry)
+	record.FetchTime += time.Since(imageFetchStartTime)
 	if err != nil {
-		if err == storage.ErrImageNotFound {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if err == storage.ErrImageNotFound {
 			RespondNotFound(w)
 		} else if err == resource.ErrOriginalImageNotFound {
 			RespondNotFound(w)
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 		return
 	}
-	logger.TrackResult("fetch image from storage", imageFetchStartTime)
 
-	if request.Geometry.NeedsOriginalImage && !request.Geometry.NeedsManualCrop {
-		RespondImage(w, image.Body)
+	// the rotation persisted for the image corrects it before the rotation of the geometry.
+	rotate := (image.Rotation + request.Geometry.Rotate) % 360
+
+	// dpr is lowered for small originals, so it is known only after the image is fetched.
+	var contentDPR float64
+	if request.NeedsResize() && request.Geometry.DPR != 0 {
+		originalWidth, originalHeight := image.OriginalWidth, image.OriginalHeight
+		if resizer.RotatesSize(rotate) {
+			originalWidth, originalHeight = originalHeight, originalWidth
+		}
+		contentDPR = request.Geometry.DPRFor(originalWidth, originalHeight)
+	}
+
+	SetCacheHeaders(w, request.Category, request.ETag(image.Version, image.Rotation), image.LastModified)
+	setContentDPR(w, contentDPR)
+	if IsNotModified(r, request.ETag(image.Version, image.Rotation), image.LastModified) {
+		RespondNotModified(w)
 		return
 	}
 
-	if len(request.Geometry.MiddleImageSize) != 0 {
+	if !request.NeedsResize() {
+		writeStartTime := time.Now()
 		RespondImage(w, image.Body)
+		record.WriteTime = time.Since(writeStartTime)
 		return
 	}
 
+	// derived images are looked up by the version of the fetched image, so that they are never of the previous upload.
+	useDerivedCache := resource.IsDerivedCacheEnabled(request.Category)
+	if useDerivedCache {
+		derivedFetchStartTime := time.Now()
+		derived, err := targetResource.FetchDerived(r.Context(), cacheKey.Geometry, request.Extension, image)
+		record.FetchTime += time.Since(derivedFetchStartTime)
+		if err == nil {
+			record.CacheStatus = CACHE_STATUS_DERIVED
+			cache.Set(cacheKey, &cache.Entry{
+				Body:         derived.Body,
+				ETag:         request.ETag(derived.Version, image.Rotation),
+				LastModified: derived.LastModified,
+				ContentDPR:   contentDPR,
+			}, generation)
+			respondResizedImage(w, r, request, derived.Body)
+			return
+		} else if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+			return
+		} else if err != storage.ErrImageNotFound {
+			logger.ErrorDebugContext(r.Context(), err)
+		}
+	}
+
+	record.CacheStatus = CACHE_STATUS_MISS
+
 	resizeStartTime := time.Now()
 	resizeOption := request.Geometry.ToResizeOption()
+	if contentDPR != 0 {
+		resizeOption.ScaleByDPR(contentDPR)
+	}
 	resizeOption.SizeHintHeight = image.Height
 	resizeOption.SizeHintWidth = image.Width
 	resizeOption.SourceContentType = image.ContentType
+	resizeOption.FocalPoint = image.FocalPoint
+	resizeOption.Rotate = rotate
 	resizeOption.Format = request.Extension
-	resizedImage, err := resizer.Run(image.Body, resizeOption)
+	// windows are cached per aspect ratio of the image, which is not of the rotation or flip of the geometry.
+	if request.Geometry.NeedsSmartCrop && resource.IsSmartCropCacheEnabled() && request.Geometry.Rotate == 0 && len(request.Geometry.Flip) == 0 {
+		smartCropFetchStartTime := time.Now()
+		// cached by the aspect ratio of the geometry, which is not changed by dpr.
+		focalPoint, err := targetResource.FetchSmartCrop(r.Context(), request.Geometry.Width, request.Geometry.Height, image)
+		record.FetchTime += time.Since(smartCropFetchStartTime)
+		if err == nil {
+			resizeOption.SmartCropFocalPoint = focalPoint
+		} else if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+			return
+		} else if err != storage.ErrImageNotFound {
+			logger.ErrorDebugContext(r.Context(), err)
+		}
+		resizeOption.OnSmartCrop = func(focalPoint *resizer.FocalPoint) {
+			// stored without waiting for the storage, like derived images.
+			go func() {
+				err := targetResource.StoreSmartCrop(context.Background(), request.Geometry.Width, request.Geometry.Height, focalPoint, image)
+				if err != nil {
+					logger.ErrorDebugContext(r.Context(), err)
+				}
+			}()
+		}
+	}
+	// the version and the rotation are in the key, so requests for a re-uploaded or rotated image are not shared with the old one.
+	resizeKey := strings.Join([]string{request.Category, request.Id, request.Geometry.Canonical(), request.Extension, image.Version, strconv.Itoa(image.Rotation)}, "/")
+	contentType := w.Header().Get("Content-Type")
+	resized, err, shared := resizeGroup.Do(r.Context(), resizeKey, func(ctx context.Context) (interface{}, error) {
+		resizedImage, err := resizer.Run(ctx, image.Body, resizeOption)
+		if err == nil && useDerivedCache {
+			// stored once by the request which resized, without waiting for the storage.
+			// it is not canceled with requests, because the response does not wait for it.
+			go func() {
+				err := targetResource.StoreDerived(context.Background(), cacheKey.Geometry, request.Extension, resizedImage, contentType, image)
+				if err != nil {
+					logger.ErrorDebugContext(r.Context(), err)
+				}
+			}()
+		}
+		return resizedImage, err
+	})
+	record.ResizeTime = time.Since(resizeStartTime)
+	if shared {
+		logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"key": resizeKey,
+		}).Debug("shared resize")
+	}
 	if err != nil {
-		if err == resizer.ErrTooManyRunningResizeWorker {
-			RespondServiceUnavailable(w, err)
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if err == resizer.ErrTooManyRunningResizeWorker {
+			RespondServiceUnavailable(w, r, err)
+		} else if err == engine.ErrUnsupportedImageFormat {
+			RespondBadRequest(w, err.Error())
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 		return
 	}
-	logger.TrackResult("resize image", resizeStartTime)
+	resizedImage := resized.([]byte)
+
+	cache.Set(cacheKey, &cache.Entry{
+		Body:         resizedImage,
+		ETag:         request.ETag(image.Version, image.Rotation),
+		LastModified: image.LastModified,
+		ContentDPR:   contentDPR,
+	}, generation)
+
+	respondResizedImage(w, r, request, resizedImage)
+}
+
+func respondResizedImage(w http.ResponseWriter, r *http.Request, request *ImageGetRequest, image []byte) {
+	writeStartTime := time.Now()
+	defer func() { accessLogOf(r).WriteTime = time.Since(writeStartTime) }()
 
 	if request.Extension == "data" {
-		RespondDataURI(w, resizedImage)
+		RespondDataURI(w, image)
 	} else {
-		RespondImage(w, resizedImage)
+		RespondImage(w, image)
 	}
+}
 
-	logger.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"params": r.URL.Query(),
-		"method": r.Method,
-	}).Info("success")
+// setContentDPR tells browsers the dpr of the image, so that it is laid out in CSS pixels of the geometry.
+func setContentDPR(w http.ResponseWriter, dpr float64) {
+	if dpr != 0 {
+		w.Header().Set("Content-DPR", strconv.FormatFloat(dpr, 'f', -1, 64))
+	}
 }
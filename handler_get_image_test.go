@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetImageUnsupportedFormat(t *testing.T) {
+	cases := []struct {
+		geometry string
+		code     int
+	}{
+		// the Go resize engine can not encode webp.
+		{"w=100", http.StatusBadRequest},
+		// stored images are responded as they are.
+		{"o=true", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/images/foods/"+c.geometry+"/unsupported.webp", nil)
+		GetImageHandler(w, r, httprouter.Params{
+			{Key: "type", Value: "foods"},
+			{Key: "geometry", Value: c.geometry},
+			{Key: "filename", Value: "unsupported.webp"},
+		})
+
+		if w.Code != c.code {
+			t.Errorf("%s: got %d, want %d", c.geometry, w.Code, c.code)
+		}
+	}
+}
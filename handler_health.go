@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+const (
+	CHECK_STATUS_OK   = "ok"
+	CHECK_STATUS_FAIL = "fail"
+	CHECK_STATUS_SKIP = "skip"
+)
+
+var (
+	// shuttingDown is set on graceful shutdown, so that load balancers stop sending requests.
+	shuttingDown int32
+)
+
+type CheckResult struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+type ReadinessResult struct {
+	Status string                  `json:"status"`
+	Checks map[string]*CheckResult `json:"checks"`
+}
+
+// readinessCheck must return when the context is done, which is canceled after the timeout.
+type readinessCheck func(ctx context.Context) (status string, err error)
+
+func markShuttingDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+func HealthzHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, "ok")
+}
+
+func ReadyzHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	result := checkReadiness(r.Context(), map[string]readinessCheck{
+		"shutdown": checkShutdown,
+		"storage":  checkStorage,
+		"engine":   checkEngine,
+		"queue":    checkQueue,
+	}, config.ReadinessTimeout)
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		RespondInternalServerError(w, r, err)
+		return
+	}
+
+	if result.Status != CHECK_STATUS_OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	RespondJson(w, js)
+}
+
+// checkReadiness runs checks concurrently, a check which does not finish in the timeout fails.
+func checkReadiness(ctx context.Context, checks map[string]readinessCheck, timeout time.Duration) *ReadinessResult {
+	result := &ReadinessResult{Status: CHECK_STATUS_OK, Checks: make(map[string]*CheckResult)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check readinessCheck) {
+			defer wg.Done()
+			checkResult := runCheck(ctx, check, timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[name] = checkResult
+			if checkResult.Status == CHECK_STATUS_FAIL {
+				result.Status = CHECK_STATUS_FAIL
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return result
+}
+
+// runCheck cancels the context of the check after the timeout, so that storage requests of hung checks are aborted.
+func runCheck(ctx context.Context, check readinessCheck, timeout time.Duration) *CheckResult {
+	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan *CheckResult, 1)
+	go func() {
+		status, err := check(ctx)
+		checkResult := &CheckResult{Status: status}
+		if err != nil {
+			checkResult.Error = err.Error()
+		}
+		done <- checkResult
+	}()
+
+	var checkResult *CheckResult
+	select {
+	case checkResult = <-done:
+	case <-ctx.Done():
+		checkResult = &CheckResult{Status: CHECK_STATUS_FAIL, Error: "timeout"}
+	}
+	checkResult.ElapsedMs = int64(time.Since(startTime) / time.Millisecond)
+	return checkResult
+}
+
+func checkShutdown(ctx context.Context) (string, error) {
+	if isShuttingDown() {
+		return CHECK_STATUS_FAIL, ErrShuttingDown
+	}
+	return CHECK_STATUS_OK, nil
+}
+
+func checkStorage(ctx context.Context) (string, error) {
+	err := storage.CheckReachable(ctx, config.ReadinessStorageKey)
+	if err != nil {
+		return CHECK_STATUS_FAIL, err
+	}
+	return CHECK_STATUS_OK, nil
+}
+
+func checkEngine(ctx context.Context) (string, error) {
+	err := resizer.CheckEngine()
+	if err != nil {
+		return CHECK_STATUS_FAIL, err
+	}
+	return CHECK_STATUS_OK, nil
+}
+
+func checkQueue(ctx context.Context) (string, error) {
+	if !resizer.IsWorkerMode {
+		return CHECK_STATUS_SKIP, nil
+	}
+
+	maxDepth := config.ReadinessMaxQueueDepth
+	if maxDepth == 0 {
+		maxDepth = resizer.ResizeWorkerWaitBufferNum
+	}
+	if depth := resizer.RequestPayloadLen(); depth >= maxDepth {
+		return CHECK_STATUS_FAIL, fmt.Errorf("%d resize requests are waiting, max is %d", depth, maxDepth)
+	}
+	return CHECK_STATUS_OK, nil
+}
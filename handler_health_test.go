@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		check  readinessCheck
+		status string
+		err    string
+	}{
+		{"ok", func(ctx context.Context) (string, error) { return CHECK_STATUS_OK, nil }, CHECK_STATUS_OK, ""},
+		{"skip", func(ctx context.Context) (string, error) { return CHECK_STATUS_SKIP, nil }, CHECK_STATUS_SKIP, ""},
+		{"fail", func(ctx context.Context) (string, error) { return CHECK_STATUS_FAIL, errors.New("unreachable") }, CHECK_STATUS_FAIL, "unreachable"},
+		{"timeout", func(ctx context.Context) (string, error) { <-ctx.Done(); return CHECK_STATUS_FAIL, ctx.Err() }, CHECK_STATUS_FAIL, "timeout"},
+	}
+
+	for _, c := range cases {
+		result := runCheck(context.Background(), c.check, 20*time.Millisecond)
+		if result.Status != c.status || result.Error != c.err {
+			t.Errorf("%s: got %+v", c.name, *result)
+		}
+	}
+
+	// storage requests of the timed out check are not left running.
+	canceled := make(chan error, 1)
+	runCheck(context.Background(), func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return CHECK_STATUS_FAIL, ctx.Err()
+	}, 20*time.Millisecond)
+	select {
+	case err := <-canceled:
+		if err != context.DeadlineExceeded {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("context of the timed out check is not canceled")
+	}
+}
+
+func TestCheckReadiness(t *testing.T) {
+	ok := func(ctx context.Context) (string, error) { return CHECK_STATUS_OK, nil }
+	skip := func(ctx context.Context) (string, error) { return CHECK_STATUS_SKIP, nil }
+	fail := func(ctx context.Context) (string, error) { return CHECK_STATUS_FAIL, errors.New("unreachable") }
+
+	result := checkReadiness(context.Background(), map[string]readinessCheck{"a": ok, "b": skip}, time.Second)
+	if result.Status != CHECK_STATUS_OK || len(result.Checks) != 2 {
+		t.Errorf("got %+v", *result)
+	}
+
+	result = checkReadiness(context.Background(), map[string]readinessCheck{"a": ok, "b": skip, "c": fail}, time.Second)
+	if result.Status != CHECK_STATUS_FAIL || result.Checks["c"].Error != "unreachable" || result.Checks["a"].Status != CHECK_STATUS_OK {
+		t.Errorf("got %+v", *result)
+	}
+}
+
+func TestReadyzShuttingDown(t *testing.T) {
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	w := httptest.NewRecorder()
+	ReadyzHandler(w, httptest.NewRequest("GET", "/readyz", nil), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d before shutdown: %s", w.Code, w.Body)
+	}
+
+	markShuttingDown()
+
+	w = httptest.NewRecorder()
+	ReadyzHandler(w, httptest.NewRequest("GET", "/readyz", nil), nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d on shutdown", w.Code)
+	}
+
+	result := &ReadinessResult{}
+	err := json.Unmarshal(w.Body.Bytes(), result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Checks["shutdown"].Status != CHECK_STATUS_FAIL || result.Checks["storage"].Status != CHECK_STATUS_OK {
+		t.Errorf("got %s", w.Body)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/resource"
+	"github.com/tokubai/kinu/storage"
+)
+
+const IMAGE_INFO_FILENAME = "info.json"
+
+// ImageInfoHandler responds /images/:type/:id/info.json, it shares the route with GetImageHandler,
+// so the id is in the geometry parameter.
+func ImageInfoHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	imageType := ps.ByName("type")
+	imageId := ps.ByName("geometry")
+	if len(imageType) == 0 || len(imageId) == 0 {
+		RespondBadRequest(w, "required image type and id.")
+		return
+	}
+
+	accessLogOf(r).SetImage(imageType, imageId)
+
+	info, err := resource.New(imageType, imageId).Info(r.Context())
+	if err != nil {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if err == storage.ErrImageNotFound {
+			RespondNotFound(w)
+		} else {
+			RespondInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	j, err := json.Marshal(info)
+	if err != nil {
+		RespondInternalServerError(w, r, err)
+		return
+	}
+	RespondJson(w, j)
+}
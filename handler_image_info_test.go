@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/config"
+)
+
+func TestImageInfoRequiresSignature(t *testing.T) {
+	defer func(secrets []string) { config.URLSignatureSecrets = secrets }(config.URLSignatureSecrets)
+	config.URLSignatureSecrets = []string{"secret"}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/images/foods/1/info.json", nil)
+	GetImageHandler(w, r, httprouter.Params{
+		{Key: "type", Value: "foods"},
+		{Key: "geometry", Value: "1"},
+		{Key: "filename", Value: IMAGE_INFO_FILENAME},
+	})
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d for unsigned image info", w.Code)
+	}
+}
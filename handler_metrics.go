@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/metrics"
+)
+
+func MetricsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	err := metrics.Write(w)
+	if err != nil {
+		logger.ErrorDebugContext(r.Context(), err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/cache"
+	"github.com/tokubai/kinu/engine"
+	"github.com/tokubai/kinu/resource"
+	"github.com/tokubai/kinu/storage"
+)
+
+// RotateImageHandler persists the rotation of the image from the r form value, 0 clears it.
+func RotateImageHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	imageType := ps.ByName("type")
+	if len(imageType) == 0 {
+		RespondBadRequest(w, "required image type.")
+		return
+	}
+
+	imageId := ps.ByName("id")
+	if len(imageId) == 0 {
+		RespondBadRequest(w, "required id.")
+		return
+	}
+
+	accessLogOf(r).SetImage(imageType, imageId)
+
+	degrees, err := strconv.Atoi(r.FormValue("r"))
+	if err != nil || degrees != 0 && !engine.IsValidRotation(degrees) {
+		RespondBadRequest(w, "r must be 0, 90, 180 or 270.")
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err = resource.New(imageType, imageId).Rotate(ctx, degrees)
+	// some sizes may be rotated even on errors.
+	cache.InvalidateResource(imageType, imageId)
+	if err != nil {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if err == storage.ErrImageNotFound {
+			RespondNotFound(w)
+		} else if err == resource.ErrRotationNotSupported {
+			RespondBadRequest(w, err.Error())
+		} else {
+			RespondInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	RespondNoContent(w)
+}
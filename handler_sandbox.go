@@ -5,8 +5,8 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/satori/go.uuid"
-	"github.com/sirupsen/logrus"
-	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/cache"
+	"github.com/tokubai/kinu/resizer"
 	"github.com/tokubai/kinu/resource"
 )
 
@@ -19,10 +19,11 @@ func UploadImageToSandboxHandler(w http.ResponseWriter, r *http.Request, ps http
 
 	uid, err := uuid.NewV4()
 	if err != nil {
-		RespondInternalServerError(w, err)
+		RespondInternalServerError(w, r, err)
 		return
 	}
 	imageId := uid.String()
+	accessLogOf(r).SetImage(SANDBOX_IMAGE_TYPE, imageId)
 
 	file, _, err := r.FormFile("image")
 	if err != nil {
@@ -30,22 +31,27 @@ func UploadImageToSandboxHandler(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	err = resource.New(SANDBOX_IMAGE_TYPE, imageId).Store(file)
+	focalPoint, err := resizer.ParseFocalPoint(r.FormValue("fx"), r.FormValue("fy"))
 	if err != nil {
-		if _, ok := err.(*ErrInvalidRequest); ok {
+		RespondBadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err = resource.New(SANDBOX_IMAGE_TYPE, imageId).Store(ctx, file, focalPoint)
+	if err != nil {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if _, ok := err.(*ErrInvalidRequest); ok {
 			RespondBadRequest(w, err.Error())
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 	}
 
-	RespondImageUploadSuccessJson(w, SANDBOX_IMAGE_TYPE, imageId)
-
-	logger.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"params": r.URL.Query(),
-		"method": r.Method,
-	}).Info("success")
+	RespondImageUploadSuccessJson(w, r, SANDBOX_IMAGE_TYPE, imageId)
 }
 
 func ApplyFromSandboxHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -71,18 +77,22 @@ func ApplyFromSandboxHandler(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	err := resource.New(SANDBOX_IMAGE_TYPE, sandboxId).MoveTo(imageType, imageId)
+	accessLogOf(r).SetImage(imageType, imageId)
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err := resource.New(SANDBOX_IMAGE_TYPE, sandboxId).MoveTo(ctx, imageType, imageId)
 
 	if err != nil {
-		RespondInternalServerError(w, err)
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else {
+			RespondInternalServerError(w, r, err)
+		}
 		return
 	}
+	cache.InvalidateResource(imageType, imageId)
 
-	RespondImageUploadSuccessJson(w, imageType, imageId)
-
-	logger.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"params": r.URL.Query(),
-		"method": r.Method,
-	}).Info("success")
+	RespondImageUploadSuccessJson(w, r, imageType, imageId)
 }
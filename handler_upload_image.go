@@ -4,8 +4,8 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/sirupsen/logrus"
-	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/cache"
+	"github.com/tokubai/kinu/resizer"
 	"github.com/tokubai/kinu/resource"
 )
 
@@ -26,27 +26,35 @@ func UploadImageHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
+	accessLogOf(r).SetImage(imageType, imageId)
+
 	file, _, err := r.FormFile("image")
 	if err != nil {
 		RespondBadRequest(w, "invalid file")
 		return
 	}
 
-	err = resource.New(imageType, imageId).Store(file)
+	focalPoint, err := resizer.ParseFocalPoint(r.FormValue("fx"), r.FormValue("fy"))
 	if err != nil {
-		if _, ok := err.(*ErrInvalidRequest); ok {
+		RespondBadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err = resource.New(imageType, imageId).Store(ctx, file, focalPoint)
+	if err != nil {
+		if ctxErr := contextError(r, err); ctxErr != nil {
+			RespondCanceled(w, r, ctxErr)
+		} else if _, ok := err.(*ErrInvalidRequest); ok {
 			RespondBadRequest(w, err.Error())
 		} else {
-			RespondInternalServerError(w, err)
+			RespondInternalServerError(w, r, err)
 		}
 		return
 	}
+	cache.InvalidateResource(imageType, imageId)
 
-	RespondImageUploadSuccessJson(w, imageType, imageId)
-
-	logger.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"params": r.URL.Query(),
-		"method": r.Method,
-	}).Info("success")
+	RespondImageUploadSuccessJson(w, r, imageType, imageId)
 }
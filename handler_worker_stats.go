@@ -30,7 +30,7 @@ func WorkerStatsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	})
 
 	if err != nil {
-		RespondInternalServerError(w, err)
+		RespondInternalServerError(w, r, err)
 	}
 
 	RespondJson(w, js)
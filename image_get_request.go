@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/engine"
 	"github.com/tokubai/kinu/logger"
 	"github.com/tokubai/kinu/resizer"
 	"github.com/tokubai/kinu/resource"
@@ -15,6 +20,7 @@ type ImageGetRequest struct {
 	Category  string
 	Id        string
 	Geometry  *resizer.Geometry
+	Preset    string
 	Extension string
 }
 
@@ -63,16 +69,67 @@ func NewImageGetRequest(ps httprouter.Params) (*ImageGetRequest, error) {
 		return nil, &ErrInvalidRequest{Message: "invalid filename"}
 	}
 
-	geometry, err := resizer.ParseGeometry(ps.ByName("geometry"))
+	var geometry *resizer.Geometry
+	var err error
+	preset, isPreset := resizer.PresetName(ps.ByName("geometry"))
+	if isPreset {
+		geometry, err = resizer.ParsePresetGeometry(imageType, preset)
+	} else if resizer.IsPresetOnlyCategory(imageType) {
+		err = &resizer.ErrInvalidGeometry{Message: imageType + " only accepts preset geometry."}
+	} else if config.CanonicalGeometryRedirect {
+		geometry, err = resizer.ParseGeometryInAnyOrder(ps.ByName("geometry"))
+	} else {
+		geometry, err = resizer.ParseGeometry(ps.ByName("geometry"))
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	logger.WithFields(logrus.Fields{
 		"geometry":   geometry.ToString(),
+		"preset":     preset,
 		"image_type": imageType,
 		"image_id":   id,
 	}).Debug("parse success image get request.")
 
-	return &ImageGetRequest{Category: imageType, Id: id, Geometry: geometry, Extension: ext}, nil
+	return &ImageGetRequest{Category: imageType, Id: id, Geometry: geometry, Preset: preset, Extension: ext}, nil
+}
+
+// CanonicalGeometry is `p=name` for preset requests, otherwise the canonical form of the geometry.
+func (r *ImageGetRequest) CanonicalGeometry() string {
+	if len(r.Preset) != 0 {
+		return "p=" + r.Preset
+	}
+	return r.Geometry.Canonical()
+}
+
+func (r *ImageGetRequest) IsCanonical(ps httprouter.Params) bool {
+	return ps.ByName("geometry") == r.CanonicalGeometry()
+}
+
+func (r *ImageGetRequest) CanonicalPath(ps httprouter.Params) string {
+	return "/images/" + r.Category + "/" + r.CanonicalGeometry() + "/" + ps.ByName("filename")
+}
+
+// NeedsResize is false when the stored original or middle image is responded as it is.
+func (r *ImageGetRequest) NeedsResize() bool {
+	if r.Geometry.NeedsOriginalImage && !r.Geometry.NeedsManualCrop {
+		return false
+	}
+	return len(r.Geometry.MiddleImageSize) == 0
+}
+
+// ETag is a strong entity tag of the response, derived from the source object version and rotation, the canonical geometry,
+// the output format and the resize engine which changes output bytes. empty when the version is unknown.
+// the rotation is left out when it is not set, so that tags of images never rotated are unchanged.
+func (r *ImageGetRequest) ETag(version string, rotation int) string {
+	if len(version) == 0 {
+		return ""
+	}
+	fields := []string{version, r.Geometry.Canonical(), r.Extension, engine.SelectedEngineType()}
+	if rotation != 0 {
+		fields = append(fields, "r"+strconv.Itoa(rotation))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
 }
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns the context of the request, log lines with the context have the request id.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request id of the context, empty when the context is not of a request.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithContext returns the entry with the request id of the context.
+func WithContext(ctx context.Context) *logrus.Entry {
+	if requestID := RequestID(ctx); len(requestID) != 0 {
+		return logrus.WithField("request_id", requestID)
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// ErrorDebugContext is ErrorDebug with the request id of the context.
+func ErrorDebugContext(ctx context.Context, err error) error {
+	if logrus.GetLevel() > logrus.DebugLevel {
+		return err
+	}
+
+	_, file, line, _ := runtime.Caller(1)
+	WithContext(ctx).WithFields(logrus.Fields{
+		"file": file + ":" + strconv.Itoa(line),
+	}).Error(err.Error())
+
+	return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,12 +11,16 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/getsentry/raven-go"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/auth"
+	"github.com/tokubai/kinu/config"
 	"github.com/tokubai/kinu/engine"
 	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/storage"
 	"github.com/vincent-petithory/dataurl"
 	"github.com/zenazn/goji/bind"
 	"github.com/zenazn/goji/graceful"
@@ -24,10 +29,14 @@ import (
 const (
 	DEFAULT_BIND = "127.0.0.1:8080"
 	VERSION      = "1.0.1"
+
+	// same as nginx, responded when the client closed the request before the response.
+	STATUS_CLIENT_CLOSED_REQUEST = 499
 )
 
 var (
 	ErrInvalidImageExt = errors.New("supported image type is only jpg/jpeg")
+	ErrShuttingDown    = errors.New("kinu is shutting down")
 	UseSentry          = false
 )
 
@@ -37,6 +46,8 @@ func main() {
 	engine.Initialize()
 	defer engine.Finalize()
 
+	storage.Initialize()
+
 	router := httprouter.New()
 
 	if os.Getenv("KINU_DEBUG") == "1" {
@@ -49,14 +60,31 @@ func main() {
 		raven.SetDSN(ravenDSN)
 	}
 
-	router.GET("/images/:type/:geometry/:filename", GetImageHandler)
+	route(router, "GET", "/images/:type/:geometry/:filename", GetImageHandler)
+
+	var authenticator auth.Authenticator
+	apiKeyFile := os.Getenv("KINU_API_KEY_FILE")
+	if len(apiKeyFile) != 0 {
+		a, err := auth.LoadAPIKeyAuthenticator(apiKeyFile)
+		if err != nil {
+			panic(err)
+		}
+		authenticator = a
+	}
 
-	router.POST("/upload", UploadImageHandler)
-	router.POST("/sandbox", UploadImageToSandboxHandler)
-	router.POST("/sandbox/attach", ApplyFromSandboxHandler)
+	route(router, "POST", "/upload", Authorize(authenticator, auth.OPERATION_UPLOAD, formCategory, UploadImageHandler))
+	route(router, "POST", "/sandbox", Authorize(authenticator, auth.OPERATION_UPLOAD, noCategory, UploadImageToSandboxHandler))
+	route(router, "POST", "/sandbox/attach", Authorize(authenticator, auth.OPERATION_ATTACH, formCategory, ApplyFromSandboxHandler))
+	route(router, "DELETE", "/images/:type/:id", Authorize(authenticator, auth.OPERATION_DELETE, pathCategory, DeleteImageHandler))
+	// rotating is allowed to keys which can upload, the image can be replaced by a rotated one anyway.
+	route(router, "PUT", "/images/:type/:id/rotation", Authorize(authenticator, auth.OPERATION_UPLOAD, pathCategory, RotateImageHandler))
 
-	router.GET("/version", VersionHandler)
-	router.GET("/worker/stats", WorkerStatsHandler)
+	route(router, "GET", "/version", VersionHandler)
+	route(router, "GET", "/healthz", HealthzHandler)
+	route(router, "GET", "/readyz", ReadyzHandler)
+	route(router, "GET", "/worker/stats", WorkerStatsHandler)
+	route(router, "GET", "/cache/stats", CacheStatsHandler)
+	route(router, "GET", "/metrics", MetricsHandler)
 
 	addr := os.Getenv("KINU_BIND")
 	if len(addr) == 0 {
@@ -66,6 +94,9 @@ func main() {
 	graceful.HandleSignals()
 	graceful.PreHook(func() {
 		logger.Info("kinu received graceful shutdown signal.")
+		markShuttingDown()
+		// listeners are closed right after prehooks, wait for load balancers to see /readyz failing.
+		time.Sleep(config.ShutdownDrainDelay)
 	})
 	graceful.PostHook(func() {
 		logger.Info("kinu stopped.")
@@ -81,6 +112,11 @@ func main() {
 	graceful.Wait()
 }
 
+// route registers the handle, requests are counted by the path pattern and logged.
+func route(router *httprouter.Router, method string, path string, handle httprouter.Handle) {
+	router.Handle(method, path, Instrument(path, WithAccessLog(WithRequestTimeout(config.RequestTimeout, handle))))
+}
+
 func HandlePprof(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	switch p.ByName("pprof") {
 	case "/cmdline":
@@ -122,20 +158,72 @@ func RespondBadRequest(w http.ResponseWriter, reason string) {
 	w.WriteHeader(http.StatusBadRequest)
 }
 
+func RespondMovedPermanently(w http.ResponseWriter, r *http.Request, location string) {
+	// content type of the image is already set by the handler.
+	w.Header().Del("Content-Type")
+	http.Redirect(w, r, location, http.StatusMovedPermanently)
+}
+
+func RespondNotModified(w http.ResponseWriter) {
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+func RespondNoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RespondUnauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.Header().Set("X-Kinu-Unauthorized-Reason", reason)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func RespondForbidden(w http.ResponseWriter, reason string) {
+	w.Header().Set("X-Kinu-Forbidden-Reason", reason)
+	w.WriteHeader(http.StatusForbidden)
+}
+
 func RespondNotFound(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
-func RespondInternalServerError(w http.ResponseWriter, err error) {
+func RespondInternalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	if UseSentry {
-		raven.CaptureError(err, nil)
+		var tags map[string]string
+		if requestID := logger.RequestID(r.Context()); len(requestID) != 0 {
+			tags = map[string]string{"request_id": requestID}
+		}
+		raven.CaptureError(err, tags)
 	}
-	logger.ErrorDebug(err)
+	logger.ErrorDebugContext(r.Context(), err)
 	w.WriteHeader(http.StatusInternalServerError)
 }
 
-func RespondServiceUnavailable(w http.ResponseWriter, err error) {
-	logger.ErrorDebug(err)
+// RespondCanceled responds when the request is canceled by the client or exceeded the request timeout.
+func RespondCanceled(w http.ResponseWriter, r *http.Request, err error) {
+	logger.ErrorDebugContext(r.Context(), err)
+	if err == context.DeadlineExceeded {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	} else {
+		w.WriteHeader(STATUS_CLIENT_CLOSED_REQUEST)
+	}
+}
+
+// contextError returns the error of the request context when it is done, or err when it is an error of
+// a context, e.g. a shared fetch exceeded the deadline of another request. otherwise it returns nil.
+func contextError(r *http.Request, err error) error {
+	if r.Context().Err() != nil {
+		return r.Context().Err()
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return nil
+}
+
+func RespondServiceUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	logger.ErrorDebugContext(r.Context(), err)
 	w.WriteHeader(http.StatusServiceUnavailable)
 }
 
@@ -144,10 +232,10 @@ type UploadResult struct {
 	ImageId   string `json:"id"`
 }
 
-func RespondImageUploadSuccessJson(w http.ResponseWriter, imageType string, imageId string) {
+func RespondImageUploadSuccessJson(w http.ResponseWriter, r *http.Request, imageType string, imageId string) {
 	json, err := json.Marshal(&UploadResult{ImageType: imageType, ImageId: imageId})
 	if err != nil {
-		RespondInternalServerError(w, err)
+		RespondInternalServerError(w, r, err)
 	}
 	RespondJson(w, json)
 }
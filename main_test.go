@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tokubai/kinu/engine"
+	"github.com/tokubai/kinu/storage"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "kinu")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("KINU_RESIZE_ENGINE", "Go")
+	os.Setenv("KINU_STORAGE_TYPE", "File")
+	os.Setenv("KINU_FILE_DIRECTORY", dir)
+	engine.Initialize()
+	storage.Initialize()
+
+	code := m.Run()
+
+	engine.Finalize()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
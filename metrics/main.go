@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"io"
+	"time"
+)
+
+var (
+	Default = NewRegistry()
+
+	HTTPRequests = NewCounterVec(
+		"kinu_http_requests_total",
+		"Number of HTTP requests by route and status.",
+		"route", "status")
+	HTTPResponseBytes = NewCounterVec(
+		"kinu_http_response_bytes_total",
+		"Bytes of HTTP response bodies by route.",
+		"route")
+
+	StorageFetchSeconds = NewHistogramVec(
+		"kinu_storage_fetch_seconds",
+		"Time to fetch an object from the storage backend.",
+		DefaultBuckets, "backend")
+	StorageErrors = NewCounterVec(
+		"kinu_storage_errors_total",
+		"Number of storage backend errors by operation, not found is not an error.",
+		"backend", "operation")
+
+	ResizeSeconds = NewHistogramVec(
+		"kinu_resize_seconds",
+		"Time to resize an image.",
+		DefaultBuckets)
+	ResizeQueueWaitSeconds = NewHistogramVec(
+		"kinu_resize_queue_wait_seconds",
+		"Time a resize request waits in the worker queue.",
+		DefaultBuckets)
+	ResizeRejections = NewCounterVec(
+		"kinu_resize_rejections_total",
+		"Number of resize requests rejected because the worker queue is full.")
+)
+
+func init() {
+	Default.Register(HTTPRequests, HTTPResponseBytes, StorageFetchSeconds, StorageErrors, ResizeSeconds, ResizeQueueWaitSeconds, ResizeRejections)
+}
+
+func Register(collectors ...Collector) {
+	Default.Register(collectors...)
+}
+
+func Write(w io.Writer) error {
+	return Default.Write(w)
+}
+
+// ObserveSince records seconds elapsed from the start time.
+func ObserveSince(h *HistogramVec, startTime time.Time, labelValues ...string) {
+	h.Observe(time.Since(startTime).Seconds(), labelValues...)
+}
@@ -0,0 +1,257 @@
+// Package metrics exposes counters, histograms and gauges in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Collector writes its samples in the text format.
+type Collector interface {
+	Name() string
+	Write(w io.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+	sort.Slice(r.collectors, func(i, j int) bool { return r.collectors[i].Name() < r.collectors[j].Name() })
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.Write(buf)
+	}
+	return buf.Flush()
+}
+
+type labelSet struct {
+	names  []string
+	values map[string][]string
+}
+
+func newLabelSet(names []string) labelSet {
+	return labelSet{names: names, values: make(map[string][]string)}
+}
+
+// key must be called with the lock of the metric.
+func (l labelSet) key(values []string) string {
+	if len(values) != len(l.names) {
+		panic(fmt.Sprintf("metrics: %d label values for labels %v", len(values), l.names))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := l.values[key]; !ok {
+		l.values[key] = append([]string{}, values...)
+	}
+	return key
+}
+
+func (l labelSet) sortedKeys() []string {
+	keys := make([]string, 0, len(l.values))
+	for key := range l.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// format returns {name="value",...} of the key with extra pairs, empty when there are no labels.
+func (l labelSet) format(key string, extra ...string) string {
+	pairs := make([]string, 0, len(l.names)+len(extra)/2)
+	for i, value := range l.values[key] {
+		pairs = append(pairs, l.names[i]+`="`+escapeLabelValue(value)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabelValue(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func writeHeader(w io.Writer, name string, help string, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+type CounterVec struct {
+	name string
+	help string
+
+	mu     sync.Mutex
+	labels labelSet
+	counts map[string]float64
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: newLabelSet(labelNames), counts: make(map[string]float64)}
+	if len(labelNames) == 0 {
+		// written as 0 before the first increment.
+		c.counts[c.labels.key(nil)] = 0
+	}
+	return c
+}
+
+func (c *CounterVec) Name() string { return c.name }
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter of the label values, v must not be negative.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.labels.key(labelValues)] += v
+}
+
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// looked up without adding the label values, so that they are not written.
+	return c.counts[strings.Join(labelValues, "\xff")]
+}
+
+func (c *CounterVec) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range c.labels.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels.format(key), formatFloat(c.counts[key]))
+	}
+}
+
+type histogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu         sync.Mutex
+	labels     labelSet
+	histograms map[string]*histogram
+}
+
+// NewHistogramVec returns the histogram of upper bounds of buckets in increasing order, +Inf is implicit.
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets must be in increasing order")
+	}
+	h := &HistogramVec{name: name, help: help, buckets: buckets, labels: newLabelSet(labelNames), histograms: make(map[string]*histogram)}
+	if len(labelNames) == 0 {
+		h.histograms[h.labels.key(nil)] = &histogram{buckets: make([]uint64, len(buckets))}
+	}
+	return h
+}
+
+func (h *HistogramVec) Name() string { return h.name }
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.labels.key(labelValues)
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{buckets: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+
+	// buckets are counted cumulatively on write.
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		hist.buckets[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) Write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range h.labels.sortedKeys() {
+		hist := h.histograms[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels.format(key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels.format(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels.format(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels.format(key), hist.count)
+	}
+}
+
+// GaugeFunc is a gauge of the value returned by the function at scrape time.
+type GaugeFunc struct {
+	name     string
+	help     string
+	function func() float64
+}
+
+func NewGaugeFunc(name string, help string, function func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, function: function}
+}
+
+func (g *GaugeFunc) Name() string { return g.name }
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.function()))
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Number of requests.", "route", "status")
+	requests.Inc("/images/:type/:geometry/:filename", "200")
+	requests.Inc("/images/:type/:geometry/:filename", "200")
+	requests.Add(3, "/upload", "500")
+	requests.Inc(`/"quoted"\path`, "404")
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "backend")
+	latency.Observe(0.05, "S3")
+	latency.Observe(0.1, "S3")
+	latency.Observe(0.5, "S3")
+	latency.Observe(2, "S3")
+
+	depth := NewGaugeFunc("test_queue_depth", "Depth.", func() float64 { return 7 })
+
+	registry := NewRegistry()
+	registry.Register(requests, latency, depth)
+
+	buf := &bytes.Buffer{}
+	err := registry.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"# HELP test_latency_seconds Latency.",
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{backend="S3",le="0.1"} 2`,
+		`test_latency_seconds_bucket{backend="S3",le="1"} 3`,
+		`test_latency_seconds_bucket{backend="S3",le="+Inf"} 4`,
+		`test_latency_seconds_sum{backend="S3"} 2.65`,
+		`test_latency_seconds_count{backend="S3"} 4`,
+		"# HELP test_queue_depth Depth.",
+		"# TYPE test_queue_depth gauge",
+		"test_queue_depth 7",
+		"# HELP test_requests_total Number of requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="/\"quoted\"\\path",status="404"} 1`,
+		`test_requests_total{route="/images/:type/:geometry/:filename",status="200"} 2`,
+		`test_requests_total{route="/upload",status="500"} 3`,
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if v := requests.Value("/upload", "500"); v != 3 {
+		t.Errorf("value is %v", v)
+	}
+	if v := requests.Value("/upload", "200"); v != 0 {
+		t.Errorf("value of unknown labels is %v", v)
+	}
+}
+
+func TestCounterWithoutLabels(t *testing.T) {
+	rejections := NewCounterVec("test_rejections_total", "Rejections.")
+
+	buf := &bytes.Buffer{}
+	rejections.Write(buf)
+	if !strings.HasSuffix(buf.String(), "\ntest_rejections_total 0\n") {
+		t.Errorf("got %s before increment", buf.String())
+	}
+
+	rejections.Inc()
+	buf.Reset()
+	rejections.Write(buf)
+	if !strings.HasSuffix(buf.String(), "\ntest_rejections_total 1\n") {
+		t.Errorf("got %s", buf.String())
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+const (
+	REQUEST_ID_HEADER     = "X-Request-Id"
+	MAX_REQUEST_ID_LENGTH = 128
+
+	// resized image is responded from the in-memory cache.
+	CACHE_STATUS_HIT = "hit"
+	// resized image is responded from the derived image persisted in the storage.
+	CACHE_STATUS_DERIVED = "derived"
+	// image is resized for the request.
+	CACHE_STATUS_MISS = "miss"
+)
+
+// AccessLog is written as one line after the response, handlers fill in the image and time of phases.
+type AccessLog struct {
+	RequestID   string
+	Category    string
+	Id          string
+	Geometry    string
+	CacheStatus string
+
+	FetchTime  time.Duration
+	ResizeTime time.Duration
+	WriteTime  time.Duration
+}
+
+func (l *AccessLog) SetImage(category string, id string) {
+	l.Category = category
+	l.Id = id
+}
+
+type accessLogKey struct{}
+
+// accessLogOf returns the access log of the request, or a discarded one when the request is not logged.
+func accessLogOf(r *http.Request) *AccessLog {
+	if record, ok := r.Context().Value(accessLogKey{}).(*AccessLog); ok {
+		return record
+	}
+	return &AccessLog{}
+}
+
+// requestIDOf accepts X-Request-Id of the request, or generates a new one.
+func requestIDOf(r *http.Request) string {
+	requestID := r.Header.Get(REQUEST_ID_HEADER)
+	if isValidRequestID(requestID) {
+		return requestID
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		logger.ErrorDebug(err)
+		return ""
+	}
+	return uid.String()
+}
+
+// isValidRequestID accepts printable ascii without spaces, so that request ids do not break log lines.
+func isValidRequestID(requestID string) bool {
+	if len(requestID) == 0 || len(requestID) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d/time.Microsecond) / 1000
+}
+
+// WithAccessLog wraps the handle to write the access log, the request id is responded in X-Request-Id
+// and logged with log lines and sentry events of the request.
+func WithAccessLog(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		startTime := time.Now()
+
+		record := &AccessLog{RequestID: requestIDOf(r)}
+		if len(record.RequestID) != 0 {
+			w.Header().Set(REQUEST_ID_HEADER, record.RequestID)
+		}
+
+		ctx := logger.ContextWithRequestID(r.Context(), record.RequestID)
+		ctx = context.WithValue(ctx, accessLogKey{}, record)
+		recorder := &responseRecorder{ResponseWriter: w}
+		handle(recorder, r.WithContext(ctx), ps)
+
+		fields := logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"query":       r.URL.RawQuery,
+			"status":      recorder.Status(),
+			"bytes":       recorder.bytes,
+			"latency_ms":  milliseconds(time.Since(startTime)),
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		}
+		for name, value := range map[string]string{
+			"category": record.Category,
+			"id":       record.Id,
+			"geometry": record.Geometry,
+			"cache":    record.CacheStatus,
+		} {
+			if len(value) != 0 {
+				fields[name] = value
+			}
+		}
+		for name, d := range map[string]time.Duration{
+			"fetch_ms":  record.FetchTime,
+			"resize_ms": record.ResizeTime,
+			"write_ms":  record.WriteTime,
+		} {
+			if d != 0 {
+				fields[name] = milliseconds(d)
+			}
+		}
+
+		logger.WithContext(ctx).WithFields(fields).Info("access")
+	}
+}
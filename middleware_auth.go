@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/auth"
+	"github.com/tokubai/kinu/logger"
+)
+
+// FORM_CATEGORY_MAX_BYTES bounds the leading bytes of multipart bodies read to find the name field,
+// so that bodies are not spooled before the request is authorized for the category.
+const FORM_CATEGORY_MAX_BYTES = 1 << 20
+
+var (
+	ErrFormCategoryNotFound = errors.New("name must be sent before the image.")
+)
+
+// categoryOf returns the image category which the request operates, empty means no specific category.
+// errors are of the malformed request.
+type categoryOf func(r *http.Request, ps httprouter.Params) (string, error)
+
+// formCategory returns the name field same as FormValue of the handler. multipart bodies are read only
+// until the name part, and the read bytes are given back to the body for the handler.
+func formCategory(r *http.Request, ps httprouter.Params) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		// url encoded forms are read into memory within the limit of net/http.
+		err := r.ParseForm()
+		if err != nil {
+			return "", err
+		}
+		return r.FormValue("name"), nil
+	}
+
+	boundary := params["boundary"]
+	if len(boundary) == 0 {
+		return "", http.ErrMissingBoundary
+	}
+
+	body := r.Body
+	read := &bytes.Buffer{}
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(read, body), body}
+	}()
+
+	reader := multipart.NewReader(io.TeeReader(io.LimitReader(body, FORM_CATEGORY_MAX_BYTES), read), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil && read.Len() >= FORM_CATEGORY_MAX_BYTES {
+			return "", ErrFormCategoryNotFound
+		} else if err != nil {
+			return "", err
+		}
+
+		// files are not values of the form.
+		if part.FormName() != "name" || len(part.FileName()) != 0 {
+			continue
+		}
+		value, err := ioutil.ReadAll(part)
+		if err != nil && read.Len() >= FORM_CATEGORY_MAX_BYTES {
+			return "", ErrFormCategoryNotFound
+		} else if err != nil {
+			return "", err
+		}
+		return string(value), nil
+	}
+
+	// values of the body take precedence over the query.
+	return r.URL.Query().Get("name"), nil
+}
+
+func pathCategory(r *http.Request, ps httprouter.Params) (string, error) {
+	return ps.ByName("type"), nil
+}
+
+func noCategory(r *http.Request, ps httprouter.Params) (string, error) {
+	return "", nil
+}
+
+// Authorize wraps the handle to require credentials allowed to the operation,
+// requests are not authenticated when authenticator is nil.
+func Authorize(authenticator auth.Authenticator, operation auth.Operation, category categoryOf, handle httprouter.Handle) httprouter.Handle {
+	if authenticator == nil {
+		return handle
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			RespondUnauthorized(w, err.Error())
+			return
+		}
+
+		c, err := category(r, ps)
+		if err != nil {
+			RespondBadRequest(w, err.Error())
+			return
+		}
+
+		err = principal.Authorize(operation, c)
+		if err != nil {
+			if _, ok := err.(*auth.ErrForbidden); ok {
+				RespondForbidden(w, err.Error())
+			} else {
+				RespondInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"principal": principal.Name(),
+			"operation": operation,
+			"category":  c,
+		}).Debug("authorized")
+
+		handle(w, r, ps)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/auth"
+)
+
+// multipartRequest builds an upload request of the fields in the order, image is a file field.
+func multipartRequest(t *testing.T, fields [][2]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, field := range fields {
+		var err error
+		if field[0] == "image" {
+			var part io.Writer
+			part, err = writer.CreateFormFile("image", "image.jpg")
+			if err == nil {
+				_, err = part.Write([]byte(field[1]))
+			}
+		} else {
+			err = writer.WriteField(field[0], field[1])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+
+	r := httptest.NewRequest("POST", "/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer secret")
+	return r
+}
+
+func TestAuthorizeFormCategory(t *testing.T) {
+	authenticator, err := auth.NewAPIKeyAuthenticator([]*auth.APIKey{
+		{KeyName: "web", Key: "secret", Categories: []string{"foods"}, Operations: []auth.Operation{auth.OPERATION_UPLOAD}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	largeImage := strings.Repeat("x", FORM_CATEGORY_MAX_BYTES)
+	urlEncoded := func(body string) *http.Request {
+		r := httptest.NewRequest("POST", "/sandbox/attach", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer secret")
+		return r
+	}
+	malformed := multipartRequest(t, [][2]string{{"name", "foods"}})
+	malformed.Header.Set("Content-Type", "multipart/form-data; boundary=other")
+
+	cases := []struct {
+		name  string
+		r     *http.Request
+		code  int
+		image string
+	}{
+		{"name before image", multipartRequest(t, [][2]string{{"id", "1"}, {"name", "foods"}, {"image", "jpeg"}}), http.StatusOK, "jpeg"},
+		{"name after small image", multipartRequest(t, [][2]string{{"image", "jpeg"}, {"name", "foods"}}), http.StatusOK, "jpeg"},
+		{"name before large image", multipartRequest(t, [][2]string{{"name", "foods"}, {"image", largeImage}}), http.StatusOK, largeImage},
+		{"forbidden category", multipartRequest(t, [][2]string{{"name", "users"}, {"image", "jpeg"}}), http.StatusForbidden, ""},
+		{"name after large image", multipartRequest(t, [][2]string{{"image", largeImage}, {"name", "users"}}), http.StatusBadRequest, ""},
+		{"malformed form", malformed, http.StatusBadRequest, ""},
+		{"url encoded", urlEncoded("name=foods&id=1"), http.StatusOK, ""},
+		{"url encoded forbidden category", urlEncoded("name=users&id=1"), http.StatusForbidden, ""},
+	}
+
+	for _, c := range cases {
+		handled := false
+		handle := Authorize(authenticator, auth.OPERATION_UPLOAD, formCategory, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			handled = true
+			// the handler parses the whole body, which is given back after the category is read.
+			if r.FormValue("name") != "foods" {
+				t.Errorf("%s: got name %q in the handler", c.name, r.FormValue("name"))
+			}
+			if len(c.image) == 0 {
+				return
+			}
+			file, _, err := r.FormFile("image")
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				return
+			}
+			defer file.Close()
+			image, _ := ioutil.ReadAll(file)
+			if string(image) != c.image {
+				t.Errorf("%s: got %d bytes of image, want %d", c.name, len(image), len(c.image))
+			}
+		})
+
+		w := httptest.NewRecorder()
+		handle(w, c.r, nil)
+		if w.Code != c.code {
+			t.Errorf("%s: got %d, want %d", c.name, w.Code, c.code)
+		}
+		if handled != (c.code == http.StatusOK) {
+			t.Errorf("%s: handled is %v", c.name, handled)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/metrics"
+)
+
+// responseRecorder remembers the status and bytes of the response written by the handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Instrument wraps the handle to count requests by the route pattern and status, and bytes served.
+func Instrument(route string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		recorder := &responseRecorder{ResponseWriter: w}
+		handle(recorder, r, ps)
+
+		metrics.HTTPRequests.Inc(route, strconv.Itoa(recorder.Status()))
+		metrics.HTTPResponseBytes.Add(float64(recorder.bytes), route)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tokubai/kinu/config"
+)
+
+// WithRequestTimeout wraps the handle to cancel the request context after the timeout,
+// storage operations and queued resizes of the request are aborted. 0 means no timeout.
+func WithRequestTimeout(timeout time.Duration, handle httprouter.Handle) httprouter.Handle {
+	if timeout == 0 {
+		return handle
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		handle(w, r.WithContext(ctx), ps)
+	}
+}
+
+// detachedContext has values of the parent, but is never canceled with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// writeContext returns the context of storage writes of the request, which is not canceled by the client
+// or the request timeout, so that images are not left partially written. it is canceled after the write timeout.
+func writeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := context.Context(detachedContext{parent: r.Context()})
+	if config.WriteTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.WriteTimeout)
+}
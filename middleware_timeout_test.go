@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tokubai/kinu/config"
+)
+
+type contextKey struct{}
+
+func TestWriteContext(t *testing.T) {
+	defer func(timeout time.Duration) { config.WriteTimeout = timeout }(config.WriteTimeout)
+	config.WriteTimeout = time.Minute
+
+	ctx, cancelRequest := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "request"))
+	r := httptest.NewRequest("POST", "/upload", nil).WithContext(ctx)
+
+	writeCtx, cancel := writeContext(r)
+	defer cancel()
+
+	cancelRequest()
+	if writeCtx.Err() != nil {
+		t.Errorf("canceled with the request: %v", writeCtx.Err())
+	}
+	if writeCtx.Value(contextKey{}) != "request" {
+		t.Errorf("values of the request are lost")
+	}
+	if deadline, ok := writeCtx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("got deadline %v, %v", deadline, ok)
+	}
+
+	cancel()
+	if writeCtx.Err() != context.Canceled {
+		t.Errorf("got %v after canceled", writeCtx.Err())
+	}
+}
@@ -1,8 +1,8 @@
 package resizer
 
-import(
-	"math"
+import (
 	"fmt"
+	"math"
 )
 
 type CoodinatesCalculator struct {
@@ -10,6 +10,10 @@ type CoodinatesCalculator struct {
 	ImageHeight int
 	Width       int
 	Height      int
+
+	// Gravity of the request takes precedence over FocalPoint of the image for AutoCrop.
+	Gravity    string
+	FocalPoint *FocalPoint
 }
 
 type ErrInvalidOption struct {
@@ -23,7 +27,7 @@ func NewCoodinatesCalculator(option *ResizeOption) (*CoodinatesCalculator, error
 	if option.Width <= 0 && option.Height <= 0 {
 		return nil, &ErrInvalidOption{Message: "option must specify Width or Height"}
 	}
-	return &CoodinatesCalculator{Width: option.Width, Height: option.Height}, nil
+	return &CoodinatesCalculator{Width: option.Width, Height: option.Height, Gravity: option.Gravity, FocalPoint: option.FocalPoint}, nil
 }
 
 func (c *CoodinatesCalculator) SetImageSize(width int, height int) {
@@ -48,8 +52,20 @@ func (c *CoodinatesCalculator) Resize() (coodinates *Coodinates) {
 	return coodinates
 }
 
+// focalPoint is the point the auto crop is centered on, the center of the image by default.
+func (c *CoodinatesCalculator) focalPoint() FocalPoint {
+	if focalPoint, ok := gravities[c.Gravity]; ok {
+		return focalPoint
+	}
+	if c.FocalPoint != nil {
+		return *c.FocalPoint
+	}
+	return centerFocalPoint
+}
+
 func (c *CoodinatesCalculator) AutoCrop() (coodinates *Coodinates) {
 	coodinates = &Coodinates{CropHeight: c.Height, CropWidth: c.Width}
+	focalPoint := c.focalPoint()
 
 	heightScaleRatio := float64(c.Height) / float64(c.ImageHeight)
 	widthScaleRatio := float64(c.Width) / float64(c.ImageWidth)
@@ -57,17 +73,50 @@ func (c *CoodinatesCalculator) AutoCrop() (coodinates *Coodinates) {
 	scaleRatio := math.Max(heightScaleRatio, widthScaleRatio)
 
 	if heightScaleRatio > widthScaleRatio {
-		coodinates.WidthOffset = int((float64(c.ImageWidth)*scaleRatio - float64(c.Width)) / float64(2.0))
 		coodinates.ResizeHeight = c.Height
 		coodinates.ResizeWidth = int(float64(c.ImageWidth) * scaleRatio)
+		coodinates.WidthOffset = cropOffset(focalPoint.X, coodinates.ResizeWidth, c.Width)
 	} else {
-		coodinates.HeightOffset = int((float64(c.ImageHeight)*scaleRatio - float64(c.Height)) / float64(2.0))
 		coodinates.ResizeHeight = int(float64(c.ImageHeight) * scaleRatio)
 		coodinates.ResizeWidth = c.Width
+		coodinates.HeightOffset = cropOffset(focalPoint.Y, coodinates.ResizeHeight, c.Height)
 	}
 	return coodinates
 }
 
+// Contain resizes the image within the size, and extends it to the size placed by the gravity.
+func (c *CoodinatesCalculator) Contain() (coodinates *Coodinates) {
+	coodinates = c.Resize()
+	coodinates.ExtendWidth, coodinates.ExtendHeight = c.Width, c.Height
+
+	placement, ok := gravities[c.Gravity]
+	if !ok {
+		placement = centerFocalPoint
+	}
+	coodinates.ExtendX = int(float64(c.Width-coodinates.ResizeWidth) * placement.X)
+	coodinates.ExtendY = int(float64(c.Height-coodinates.ResizeHeight) * placement.Y)
+	return coodinates
+}
+
+func (c *CoodinatesCalculator) Fill() (coodinates *Coodinates) {
+	return &Coodinates{ResizeWidth: c.Width, ResizeHeight: c.Height}
+}
+
+// Inside is Resize without enlarging images smaller than the size.
+func (c *CoodinatesCalculator) Inside() (coodinates *Coodinates) {
+	if (c.Width == 0 || c.ImageWidth <= c.Width) && (c.Height == 0 || c.ImageHeight <= c.Height) {
+		return &Coodinates{ResizeWidth: c.ImageWidth, ResizeHeight: c.ImageHeight}
+	}
+	return c.Resize()
+}
+
+// Outside resizes the image to cover the size, same as AutoCrop without cropping.
+func (c *CoodinatesCalculator) Outside() (coodinates *Coodinates) {
+	coodinates = c.AutoCrop()
+	coodinates.CropWidth, coodinates.CropHeight, coodinates.WidthOffset, coodinates.HeightOffset = 0, 0, 0, 0
+	return coodinates
+}
+
 func (c *CoodinatesCalculator) ManualCrop(option *ResizeOption) (coodinates *Coodinates) {
 	coodinates = &Coodinates{}
 
@@ -104,11 +153,20 @@ func (c *CoodinatesCalculator) ManualCrop(option *ResizeOption) (coodinates *Coo
 }
 
 func (c *CoodinatesCalculator) Calc(option *ResizeOption) (coodinates *Coodinates) {
-	if option.NeedsAutoCrop {
+	switch {
+	case option.NeedsAutoCrop || option.Fit == FIT_COVER:
 		return c.AutoCrop()
-	} else if option.NeedsManualCrop {
+	case option.NeedsManualCrop:
 		return c.ManualCrop(option)
-	} else {
+	case option.Fit == FIT_CONTAIN:
+		return c.Contain()
+	case option.Fit == FIT_FILL:
+		return c.Fill()
+	case option.Fit == FIT_INSIDE:
+		return c.Inside()
+	case option.Fit == FIT_OUTSIDE:
+		return c.Outside()
+	default:
 		return c.Resize()
 	}
 }
@@ -117,6 +175,10 @@ type Coodinates struct {
 	ResizeWidth, ResizeHeight int
 	CropWidth,   CropHeight   int
 	WidthOffset, HeightOffset int
+
+	// the image is placed at ExtendX and ExtendY of the extended size.
+	ExtendWidth, ExtendHeight int
+	ExtendX,     ExtendY      int
 }
 
 func (c *Coodinates) Valid() bool {
@@ -127,13 +189,21 @@ func (c *Coodinates) CanCrop() bool {
 	return c.CropWidth > 0 && c.CropHeight > 0
 }
 
+func (c *Coodinates) CanExtend() bool {
+	return c.ExtendWidth > 0 && c.ExtendHeight > 0
+}
+
 func (c *Coodinates) ToString() string {
-	return fmt.Sprintf("ResizeWidth: %d, ResizeHeight: %d, CropWidth: %d, CropHeight: %d, WidthOffset: %d HeightOffset: %d",
+	return fmt.Sprintf("ResizeWidth: %d, ResizeHeight: %d, CropWidth: %d, CropHeight: %d, WidthOffset: %d HeightOffset: %d, ExtendWidth: %d, ExtendHeight: %d, ExtendX: %d, ExtendY: %d",
 		c.ResizeWidth,
 		c.ResizeHeight,
 		c.CropWidth,
 		c.CropHeight,
 		c.WidthOffset,
 		c.HeightOffset,
+		c.ExtendWidth,
+		c.ExtendHeight,
+		c.ExtendX,
+		c.ExtendY,
 	)
 }
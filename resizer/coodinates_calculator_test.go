@@ -0,0 +1,384 @@
+package resizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type imageSize struct {
+	name          string
+	width, height int
+}
+
+var calculatorImageSizes = []imageSize{
+	{"portrait", 600, 900},
+	{"landscape", 900, 600},
+	{"square", 500, 500},
+	{"tiny", 3, 2},
+	{"thin", 1, 281},
+	{"odd", 333, 777},
+}
+
+func TestCoodinatesCalculatorResize(t *testing.T) {
+	cases := []struct {
+		imageWidth, imageHeight int
+		width, height           int
+		want                    Coodinates
+	}{
+		{600, 900, 100, 0, Coodinates{ResizeWidth: 100, ResizeHeight: 150}},
+		{600, 900, 0, 300, Coodinates{ResizeWidth: 200, ResizeHeight: 300}},
+		{600, 900, 100, 100, Coodinates{ResizeWidth: 66, ResizeHeight: 100}},
+		{600, 900, 280, 300, Coodinates{ResizeWidth: 200, ResizeHeight: 300}},
+		{900, 600, 100, 100, Coodinates{ResizeWidth: 100, ResizeHeight: 66}},
+		{900, 600, 280, 300, Coodinates{ResizeWidth: 280, ResizeHeight: 186}},
+		{500, 500, 100, 50, Coodinates{ResizeWidth: 50, ResizeHeight: 50}},
+		{500, 500, 1000, 0, Coodinates{ResizeWidth: 1000, ResizeHeight: 1000}},
+		{3, 2, 100, 100, Coodinates{ResizeWidth: 100, ResizeHeight: 66}},
+		{3, 2, 0, 1, Coodinates{ResizeWidth: 1, ResizeHeight: 1}},
+		// float ratios are truncated, 281 * (300 / 281) is 299.99999999999994.
+		{1, 281, 50, 300, Coodinates{ResizeWidth: 1, ResizeHeight: 299}},
+		{1, 337, 50, 50, Coodinates{ResizeWidth: 0, ResizeHeight: 49}},
+		{300, 600, 100, 100, Coodinates{ResizeWidth: 50, ResizeHeight: 100}},
+	}
+
+	for _, c := range cases {
+		calculator := &CoodinatesCalculator{ImageWidth: c.imageWidth, ImageHeight: c.imageHeight, Width: c.width, Height: c.height}
+		got := calculator.Resize()
+		if *got != c.want {
+			t.Errorf("%dx%d to w=%d,h=%d: got %s, want %s", c.imageWidth, c.imageHeight, c.width, c.height, got.ToString(), c.want.ToString())
+		}
+	}
+}
+
+func TestCoodinatesCalculatorAutoCrop(t *testing.T) {
+	cases := []struct {
+		imageWidth, imageHeight int
+		width, height           int
+		want                    Coodinates
+	}{
+		{600, 900, 100, 100, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 25}},
+		{900, 600, 100, 100, Coodinates{ResizeWidth: 150, ResizeHeight: 100, CropWidth: 100, CropHeight: 100, WidthOffset: 25}},
+		{500, 500, 280, 300, Coodinates{ResizeWidth: 300, ResizeHeight: 300, CropWidth: 280, CropHeight: 300, WidthOffset: 10}},
+		{500, 500, 300, 280, Coodinates{ResizeWidth: 300, ResizeHeight: 300, CropWidth: 300, CropHeight: 280, HeightOffset: 10}},
+		{3, 2, 100, 100, Coodinates{ResizeWidth: 150, ResizeHeight: 100, CropWidth: 100, CropHeight: 100, WidthOffset: 25}},
+		{300, 600, 100, 100, Coodinates{ResizeWidth: 100, ResizeHeight: 200, CropWidth: 100, CropHeight: 100, HeightOffset: 50}},
+		{333, 777, 100, 100, Coodinates{ResizeWidth: 100, ResizeHeight: 233, CropWidth: 100, CropHeight: 100, HeightOffset: 66}},
+	}
+
+	for _, c := range cases {
+		calculator := &CoodinatesCalculator{ImageWidth: c.imageWidth, ImageHeight: c.imageHeight, Width: c.width, Height: c.height}
+		got := calculator.AutoCrop()
+		if *got != c.want {
+			t.Errorf("%dx%d to w=%d,h=%d: got %s, want %s", c.imageWidth, c.imageHeight, c.width, c.height, got.ToString(), c.want.ToString())
+		}
+	}
+}
+
+func TestCoodinatesCalculatorManualCrop(t *testing.T) {
+	cases := []struct {
+		imageWidth, imageHeight int
+		geometry                string
+		want                    Coodinates
+	}{
+		// assumed image is the same size.
+		{1000, 800, "w=100,h=100,mc=true,wo=100,ho=200,cw=300,ch=300,aw=1000",
+			Coodinates{ResizeWidth: 100, ResizeHeight: 100, CropWidth: 300, CropHeight: 300, WidthOffset: 100, HeightOffset: 200}},
+		// assumed image is half size.
+		{1000, 800, "w=100,h=100,mc=true,wo=50,ho=100,cw=150,ch=150,aw=500",
+			Coodinates{ResizeWidth: 100, ResizeHeight: 100, CropWidth: 300, CropHeight: 300, WidthOffset: 100, HeightOffset: 200}},
+		// crop region is wider than requested, narrowed around center.
+		{1000, 800, "w=100,h=100,mc=true,wo=100,ho=200,cw=400,ch=200,aw=1000",
+			Coodinates{ResizeWidth: 100, ResizeHeight: 100, CropWidth: 200, CropHeight: 200, WidthOffset: 200, HeightOffset: 200}},
+		// crop region is taller than requested, narrowed around center.
+		{1000, 800, "w=200,h=100,mc=true,wo=100,ho=100,cw=200,ch=300,aw=1000",
+			Coodinates{ResizeWidth: 200, ResizeHeight: 100, CropWidth: 200, CropHeight: 100, WidthOffset: 100, HeightOffset: 200}},
+		// assumed image width does not divide image width.
+		{1000, 1000, "w=100,h=100,mc=true,wo=10,ho=10,cw=100,ch=100,aw=300",
+			Coodinates{ResizeWidth: 100, ResizeHeight: 100, CropWidth: 333, CropHeight: 333, WidthOffset: 33, HeightOffset: 33}},
+		{3, 2, "w=100,h=100,mc=true,wo=0,ho=0,cw=2,ch=2,aw=3",
+			Coodinates{ResizeWidth: 100, ResizeHeight: 100, CropWidth: 2, CropHeight: 2}},
+	}
+
+	for _, c := range cases {
+		geometry, err := ParseGeometry(c.geometry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calculator := &CoodinatesCalculator{ImageWidth: c.imageWidth, ImageHeight: c.imageHeight, Width: geometry.Width, Height: geometry.Height}
+		got := calculator.ManualCrop(geometry.ToResizeOption())
+		if *got != c.want {
+			t.Errorf("%dx%d %s: got %s, want %s", c.imageWidth, c.imageHeight, c.geometry, got.ToString(), c.want.ToString())
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// calculatorGeometries returns geometries of every combination of the resize keys.
+func calculatorGeometries() []string {
+	geometries := make([]string, 0)
+	for _, w := range []string{"", "w=1", "w=100", "w=280", "w=1500"} {
+		for _, h := range []string{"", "h=1", "h=100", "h=300"} {
+			if len(w) == 0 && len(h) == 0 {
+				continue
+			}
+			for _, c := range []string{"", "c=true"} {
+				manualCrops := []string{""}
+				for _, offset := range []string{"wo=0,ho=0", "wo=10,ho=30"} {
+					for _, size := range []string{"cw=50,ch=50", "cw=200,ch=100", "cw=90,ch=250"} {
+						for _, aw := range []string{"aw=300", "aw=1000"} {
+							manualCrops = append(manualCrops, strings.Join([]string{"mc=true", offset, size, aw}, ","))
+						}
+					}
+				}
+				for _, mc := range manualCrops {
+					keys := make([]string, 0)
+					for _, key := range []string{w, h, c, mc} {
+						if len(key) != 0 {
+							keys = append(keys, key)
+						}
+					}
+					geometries = append(geometries, strings.Join(keys, ","))
+				}
+			}
+		}
+	}
+	return geometries
+}
+
+func TestCoodinatesCalculatorCombinations(t *testing.T) {
+	for _, size := range calculatorImageSizes {
+		for _, geo := range calculatorGeometries() {
+			name := fmt.Sprintf("%s %dx%d %s", size.name, size.width, size.height, geo)
+
+			geometry, err := ParseGeometry(geo)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			option := geometry.ToResizeOption()
+
+			calculator, err := NewCoodinatesCalculator(option)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			calculator.SetImageSize(size.width, size.height)
+			got := calculator.Calc(option)
+
+			switch {
+			case option.NeedsAutoCrop:
+				assertAutoCrop(t, name, size, option, got)
+			case option.NeedsManualCrop:
+				assertManualCrop(t, name, size, option, got)
+			default:
+				assertResize(t, name, size, option, got)
+			}
+		}
+	}
+}
+
+// scaledLength is the length scaled by the float ratio and truncated the same as the calculator,
+// e.g. 281 * (300 / 281) is 299.99999999999994 and truncated to 299.
+func scaledLength(length, numerator, denominator int) int {
+	return int(float64(length) * (float64(numerator) / float64(denominator)))
+}
+
+func assertResize(t *testing.T, name string, size imageSize, option *ResizeOption, got *Coodinates) {
+	var wantWidth, wantHeight int
+	switch {
+	case option.Height == 0:
+		wantWidth, wantHeight = option.Width, scaledLength(size.height, option.Width, size.width)
+	case option.Width == 0:
+		wantWidth, wantHeight = scaledLength(size.width, option.Height, size.height), option.Height
+	case float64(option.Width)/float64(size.width) <= float64(option.Height)/float64(size.height):
+		wantWidth, wantHeight = scaledLength(size.width, option.Width, size.width), scaledLength(size.height, option.Width, size.width)
+	default:
+		wantWidth, wantHeight = scaledLength(size.width, option.Height, size.height), scaledLength(size.height, option.Height, size.height)
+	}
+	if got.ResizeWidth != wantWidth || got.ResizeHeight != wantHeight {
+		t.Errorf("%s: %s, want %dx%d", name, got.ToString(), wantWidth, wantHeight)
+	}
+
+	// lengths of thin images are truncated to 0px, which are rejected by engines.
+	if wantWidth == 0 || wantHeight == 0 {
+		if got.Valid() {
+			t.Errorf("%s: %s must be invalid", name, got.ToString())
+		}
+		return
+	}
+	if !got.Valid() {
+		t.Errorf("%s: invalid %s", name, got.ToString())
+		return
+	}
+	if got.CanCrop() {
+		t.Errorf("%s: resize must not crop, %s", name, got.ToString())
+	}
+	if option.Width > 0 && got.ResizeWidth > option.Width || option.Height > 0 && got.ResizeHeight > option.Height {
+		t.Errorf("%s: %s is over the requested size", name, got.ToString())
+	}
+}
+
+func assertAutoCrop(t *testing.T, name string, size imageSize, option *ResizeOption, got *Coodinates) {
+	if float64(option.Height)/float64(size.height) > float64(option.Width)/float64(size.width) {
+		if want := scaledLength(size.width, option.Height, size.height); got.ResizeWidth != want {
+			t.Errorf("%s: %s, want width %d", name, got.ToString(), want)
+		}
+	} else if want := scaledLength(size.height, option.Width, size.width); got.ResizeHeight != want {
+		t.Errorf("%s: %s, want height %d", name, got.ToString(), want)
+	}
+
+	// lengths of thin images are truncated to 0px, which are rejected by engines.
+	if got.ResizeWidth == 0 || got.ResizeHeight == 0 {
+		return
+	}
+	if !got.Valid() {
+		t.Errorf("%s: invalid %s", name, got.ToString())
+		return
+	}
+
+	if option.Width == 0 || option.Height == 0 {
+		if got.CanCrop() {
+			t.Errorf("%s: auto crop without width or height must not crop, %s", name, got.ToString())
+		}
+		return
+	}
+
+	if got.CropWidth != option.Width || got.CropHeight != option.Height {
+		t.Errorf("%s: crop size of %s is not the requested size", name, got.ToString())
+	}
+	if got.ResizeWidth != option.Width && got.ResizeHeight != option.Height {
+		t.Errorf("%s: %s covers neither the requested width nor height", name, got.ToString())
+	}
+	if got.WidthOffset < 0 || got.HeightOffset < 0 ||
+		got.WidthOffset+got.CropWidth > got.ResizeWidth || got.HeightOffset+got.CropHeight > got.ResizeHeight {
+		t.Errorf("%s: crop region of %s is out of the resized image", name, got.ToString())
+	}
+
+	// crop region is centered within 1px.
+	if abs(got.WidthOffset-(got.ResizeWidth-got.CropWidth-got.WidthOffset)) > 1 ||
+		abs(got.HeightOffset-(got.ResizeHeight-got.CropHeight-got.HeightOffset)) > 1 {
+		t.Errorf("%s: crop region of %s is not centered", name, got.ToString())
+	}
+}
+
+func assertManualCrop(t *testing.T, name string, size imageSize, option *ResizeOption, got *Coodinates) {
+	if option.Width == 0 || option.Height == 0 {
+		if got.Valid() {
+			t.Errorf("%s: manual crop without width or height must be invalid, %s", name, got.ToString())
+		}
+		return
+	}
+
+	if !got.Valid() {
+		t.Errorf("%s: invalid %s", name, got.ToString())
+		return
+	}
+	if got.ResizeWidth != option.Width || got.ResizeHeight != option.Height {
+		t.Errorf("%s: resize size of %s is not the requested size", name, got.ToString())
+	}
+
+	// crop region is inside the requested region scaled from the assumed image.
+	regionLeft := option.CropWidthOffset * size.width / option.AssumptionWidth
+	regionTop := option.CropHeightOffset * size.width / option.AssumptionWidth
+	regionRight := (option.CropWidthOffset + option.CropWidth) * size.width / option.AssumptionWidth
+	regionBottom := (option.CropHeightOffset + option.CropHeight) * size.width / option.AssumptionWidth
+	if got.WidthOffset < regionLeft || got.HeightOffset < regionTop ||
+		got.WidthOffset+got.CropWidth > regionRight+1 || got.HeightOffset+got.CropHeight > regionBottom+1 {
+		t.Errorf("%s: crop region of %s is out of the requested region (%d,%d)-(%d,%d)", name, got.ToString(), regionLeft, regionTop, regionRight, regionBottom)
+	}
+
+	// crop region keeps the aspect ratio of the requested size within 1px truncation.
+	if abs(got.CropWidth*option.Height-got.CropHeight*option.Width) > option.Width+option.Height {
+		t.Errorf("%s: crop region of %s does not keep the aspect ratio", name, got.ToString())
+	}
+}
+
+func TestCoodinatesCalculatorAutoCropGravity(t *testing.T) {
+	cases := []struct {
+		imageWidth, imageHeight int
+		gravity                 string
+		focalPoint              *FocalPoint
+		want                    Coodinates
+	}{
+		{600, 900, "north", nil, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100}},
+		{600, 900, "south", nil, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 50}},
+		{600, 900, "east", nil, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 25}},
+		{900, 600, "east", nil, Coodinates{ResizeWidth: 150, ResizeHeight: 100, CropWidth: 100, CropHeight: 100, WidthOffset: 50}},
+		{900, 600, "northwest", nil, Coodinates{ResizeWidth: 150, ResizeHeight: 100, CropWidth: 100, CropHeight: 100}},
+		{600, 900, "", &FocalPoint{X: 0.5, Y: 0.4}, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 10}},
+		{600, 900, "", &FocalPoint{X: 0.5, Y: 0.9}, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 50}},
+		{900, 600, "", &FocalPoint{X: 0.1, Y: 0.5}, Coodinates{ResizeWidth: 150, ResizeHeight: 100, CropWidth: 100, CropHeight: 100}},
+		{600, 900, "center", &FocalPoint{X: 0.5, Y: 0}, Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 25}},
+	}
+
+	for _, c := range cases {
+		calculator := &CoodinatesCalculator{ImageWidth: c.imageWidth, ImageHeight: c.imageHeight, Width: 100, Height: 100, Gravity: c.gravity, FocalPoint: c.focalPoint}
+		got := calculator.AutoCrop()
+		if *got != c.want {
+			t.Errorf("%dx%d with gravity %q and focal point %+v: got %s, want %s", c.imageWidth, c.imageHeight, c.gravity, c.focalPoint, got.ToString(), c.want.ToString())
+		}
+	}
+}
+
+func TestParseFocalPoint(t *testing.T) {
+	got, err := ParseFocalPoint("0.25", "1")
+	if err != nil || *got != (FocalPoint{X: 0.25, Y: 1}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	got, err = ParseFocalPoint("", "")
+	if err != nil || got != nil {
+		t.Errorf("empty: got %+v, %v", got, err)
+	}
+
+	for _, c := range [][2]string{{"0.5", ""}, {"", "0.5"}, {"-0.1", "0.5"}, {"0.5", "1.1"}, {"a", "0.5"},
+		{"NaN", "0.5"}, {"0.5", "nan"}, {"Inf", "0.5"}, {"0.5", "-Inf"}} {
+		if _, err := ParseFocalPoint(c[0], c[1]); err == nil {
+			t.Errorf("fx=%s,fy=%s: must be invalid", c[0], c[1])
+		}
+	}
+}
+
+func TestCoodinatesCalculatorFit(t *testing.T) {
+	cases := []struct {
+		imageWidth, imageHeight int
+		geometry                string
+		want                    Coodinates
+	}{
+		{600, 900, "w=300,h=250,fit=contain", Coodinates{ResizeWidth: 166, ResizeHeight: 250, ExtendWidth: 300, ExtendHeight: 250, ExtendX: 67}},
+		{900, 600, "w=300,h=250,fit=contain", Coodinates{ResizeWidth: 300, ResizeHeight: 200, ExtendWidth: 300, ExtendHeight: 250, ExtendY: 25}},
+		{900, 600, "w=300,h=250,g=north,fit=contain", Coodinates{ResizeWidth: 300, ResizeHeight: 200, ExtendWidth: 300, ExtendHeight: 250}},
+		{900, 600, "w=300,h=250,g=southeast,fit=contain", Coodinates{ResizeWidth: 300, ResizeHeight: 200, ExtendWidth: 300, ExtendHeight: 250, ExtendY: 50}},
+		{100, 50, "w=300,h=250,fit=contain", Coodinates{ResizeWidth: 300, ResizeHeight: 150, ExtendWidth: 300, ExtendHeight: 250, ExtendY: 50}},
+		{600, 900, "w=100,h=100,fit=cover", Coodinates{ResizeWidth: 100, ResizeHeight: 150, CropWidth: 100, CropHeight: 100, HeightOffset: 25}},
+		{600, 900, "w=100,h=100,fit=fill", Coodinates{ResizeWidth: 100, ResizeHeight: 100}},
+		{600, 900, "w=100,h=100,fit=inside", Coodinates{ResizeWidth: 66, ResizeHeight: 100}},
+		{100, 50, "w=300,h=250,fit=inside", Coodinates{ResizeWidth: 100, ResizeHeight: 50}},
+		{100, 50, "w=300,fit=inside", Coodinates{ResizeWidth: 100, ResizeHeight: 50}},
+		{100, 50, "w=80,fit=inside", Coodinates{ResizeWidth: 80, ResizeHeight: 40}},
+		{600, 900, "w=100,h=100,fit=outside", Coodinates{ResizeWidth: 100, ResizeHeight: 150}},
+		{900, 600, "w=100,h=100,fit=outside", Coodinates{ResizeWidth: 150, ResizeHeight: 100}},
+	}
+
+	for _, c := range cases {
+		geometry, err := ParseGeometry(c.geometry)
+		if err != nil {
+			t.Fatalf("%s: %s", c.geometry, err)
+		}
+		option := geometry.ToResizeOption()
+		calculator, err := NewCoodinatesCalculator(option)
+		if err != nil {
+			t.Fatalf("%s: %s", c.geometry, err)
+		}
+		calculator.SetImageSize(c.imageWidth, c.imageHeight)
+		got := calculator.Calc(option)
+		if *got != c.want {
+			t.Errorf("%dx%d to %s: got %s, want %s", c.imageWidth, c.imageHeight, c.geometry, got.ToString(), c.want.ToString())
+		}
+	}
+}
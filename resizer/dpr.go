@@ -0,0 +1,98 @@
+package resizer
+
+import (
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+// Device pixel ratio multiplies the width and height of the geometry for high density screens,
+// e.g. w=400,dpr=2 resizes to 800 pixels wide to be displayed in 400 CSS pixels.
+const (
+	GEOMETRY_MIN_DPR = 1
+	GEOMETRY_MAX_DPR = 4
+)
+
+var (
+	// MaxDPR caps the device pixel ratio applied to images, requests of larger ratios are served at MaxDPR.
+	MaxDPR float64 = GEOMETRY_MAX_DPR
+)
+
+func init() {
+	maxDPR := os.Getenv("KINU_MAX_DPR")
+	if len(maxDPR) == 0 {
+		return
+	}
+
+	num, err := strconv.ParseFloat(maxDPR, 64)
+	if err != nil {
+		panic(err)
+	}
+	if !(num >= GEOMETRY_MIN_DPR && num <= GEOMETRY_MAX_DPR) {
+		panic("KINU_MAX_DPR must be between 1 and 4")
+	}
+	MaxDPR = num
+
+	logger.WithFields(logrus.Fields{
+		"max_dpr": MaxDPR,
+	}).Info("set max dpr")
+}
+
+// parseDPR parses a ratio between 1 and 4 rounded to 2 decimal places, 1 is returned as 0 which means no dpr.
+func parseDPR(value string) (float64, error) {
+	dpr, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(dpr >= GEOMETRY_MIN_DPR && dpr <= GEOMETRY_MAX_DPR) {
+		return 0, &ErrInvalidGeometry{Message: "geometry dpr must be between " + strconv.Itoa(GEOMETRY_MIN_DPR) + " and " + strconv.Itoa(GEOMETRY_MAX_DPR) + "."}
+	}
+	dpr = math.Round(dpr*100) / 100
+	if dpr == GEOMETRY_MIN_DPR {
+		return 0, nil
+	}
+	return dpr, nil
+}
+
+func formatDPR(dpr float64) string {
+	return strconv.FormatFloat(dpr, 'f', -1, 64)
+}
+
+func scaleByDPR(length int, dpr float64) int {
+	return int(math.Round(float64(length) * dpr))
+}
+
+// requestedDPR is the dpr of the geometry capped by MaxDPR, 1 when dpr is not specified.
+func (g *Geometry) requestedDPR() float64 {
+	if g.DPR == 0 {
+		return GEOMETRY_MIN_DPR
+	}
+	return math.Min(g.DPR, MaxDPR)
+}
+
+// ScaledSize is the width and height multiplied by the requested dpr, used to select the middle image.
+func (g *Geometry) ScaledSize() (width int, height int) {
+	dpr := g.requestedDPR()
+	return scaleByDPR(g.Width, dpr), scaleByDPR(g.Height, dpr)
+}
+
+// DPRFor returns the dpr applied to the image of the original size, the requested dpr is lowered
+// so that the scaled size does not exceed the original size, but never below 1.
+// unknown original width or height of 0 is not considered.
+func (g *Geometry) DPRFor(originalWidth int, originalHeight int) float64 {
+	dpr := g.requestedDPR()
+	if g.Width != 0 && originalWidth != 0 {
+		dpr = math.Min(dpr, float64(originalWidth)/float64(g.Width))
+	}
+	if g.Height != 0 && originalHeight != 0 {
+		dpr = math.Min(dpr, float64(originalHeight)/float64(g.Height))
+	}
+	// floored, so that the scaled size is still within the original size.
+	return math.Max(math.Floor(dpr*100)/100, GEOMETRY_MIN_DPR)
+}
+
+// ScaleByDPR multiplies the width and height of the option, crop regions are kept on the assumption width.
+func (o *ResizeOption) ScaleByDPR(dpr float64) {
+	o.Width = scaleByDPR(o.Width, dpr)
+	o.Height = scaleByDPR(o.Height, dpr)
+}
@@ -0,0 +1,60 @@
+package resizer
+
+import "testing"
+
+func TestGeometryDPRFor(t *testing.T) {
+	defer func(maxDPR float64) { MaxDPR = maxDPR }(MaxDPR)
+
+	cases := []struct {
+		geometry                      Geometry
+		maxDPR                        float64
+		originalWidth, originalHeight int
+		want                          float64
+	}{
+		{Geometry{Width: 400}, 4, 3000, 2000, 1},
+		{Geometry{Width: 400, DPR: 2}, 4, 3000, 2000, 2},
+		{Geometry{Width: 400, DPR: 3}, 2, 3000, 2000, 2},
+		{Geometry{Width: 400, DPR: 3}, 4, 1000, 2000, 2.5},
+		{Geometry{Width: 400, Height: 300, DPR: 3}, 4, 3000, 800, 2.66},
+		{Geometry{Height: 300, DPR: 2}, 4, 100, 450, 1.5},
+		{Geometry{Width: 400, DPR: 2}, 4, 300, 200, 1},
+		{Geometry{Width: 400, DPR: 2}, 4, 0, 0, 2},
+	}
+
+	for _, c := range cases {
+		MaxDPR = c.maxDPR
+		got := c.geometry.DPRFor(c.originalWidth, c.originalHeight)
+		if got != c.want {
+			t.Errorf("%s max %g of %dx%d: got %g, want %g", c.geometry.Canonical(), c.maxDPR, c.originalWidth, c.originalHeight, got, c.want)
+		}
+		if c.originalWidth != 0 && c.want > 1 {
+			option := c.geometry.ToResizeOption()
+			option.ScaleByDPR(got)
+			if option.Width > c.originalWidth || option.Height > c.originalHeight {
+				t.Errorf("%s of %dx%d: scaled to %dx%d", c.geometry.Canonical(), c.originalWidth, c.originalHeight, option.Width, option.Height)
+			}
+		}
+	}
+}
+
+func TestGeometryScaledSize(t *testing.T) {
+	defer func(maxDPR float64) { MaxDPR = maxDPR }(MaxDPR)
+	MaxDPR = 3
+
+	cases := []struct {
+		geometry      Geometry
+		width, height int
+	}{
+		{Geometry{Width: 400, Height: 300}, 400, 300},
+		{Geometry{Width: 400, Height: 300, DPR: 2}, 800, 600},
+		{Geometry{Width: 333, DPR: 1.5}, 500, 0},
+		{Geometry{Height: 300, DPR: 4}, 0, 900},
+	}
+
+	for _, c := range cases {
+		width, height := c.geometry.ScaledSize()
+		if width != c.width || height != c.height {
+			t.Errorf("%s: got %dx%d, want %dx%d", c.geometry.Canonical(), width, height, c.width, c.height)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package resizer
+
+import (
+	"encoding/hex"
+	"image/color"
+	"strings"
+)
+
+// Fit modes of fixed width and height, like the fit option of sharp.
+const (
+	// FIT_CONTAIN keeps the aspect ratio within the size, and pads the rest with the background color.
+	FIT_CONTAIN = "contain"
+	// FIT_COVER keeps the aspect ratio and crops to the size, same as c=true.
+	FIT_COVER = "cover"
+	// FIT_FILL stretches the image to the size ignoring the aspect ratio.
+	FIT_FILL = "fill"
+	// FIT_INSIDE keeps the aspect ratio within the size, images smaller than the size are not enlarged.
+	FIT_INSIDE = "inside"
+	// FIT_OUTSIDE keeps the aspect ratio to cover the size without cropping.
+	FIT_OUTSIDE = "outside"
+
+	DEFAULT_BACKGROUND = "ffffff"
+)
+
+var (
+	FitModes = []string{FIT_CONTAIN, FIT_COVER, FIT_FILL, FIT_INSIDE, FIT_OUTSIDE}
+)
+
+func IsValidFit(fit string) bool {
+	for _, mode := range FitModes {
+		if mode == fit {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBackground parses an opaque color of rrggbb hex, the default background is white.
+func ParseBackground(background string) (color.RGBA, error) {
+	if len(background) == 0 {
+		background = DEFAULT_BACKGROUND
+	}
+	rgb, err := hex.DecodeString(background)
+	if err != nil || len(rgb) != 3 {
+		return color.RGBA{}, &ErrInvalidOption{Message: "background must be rrggbb hex color"}
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
+
+// normalizeBackground returns the lower case background, empty for the default background.
+func normalizeBackground(background string) string {
+	background = strings.ToLower(background)
+	if background == DEFAULT_BACKGROUND {
+		return ""
+	}
+	return background
+}
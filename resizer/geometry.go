@@ -2,8 +2,11 @@ package resizer
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/tokubai/kinu/engine"
 )
 
 type ErrInvalidGeometryOrderRequest struct {
@@ -11,23 +14,32 @@ type ErrInvalidGeometryOrderRequest struct {
 	Message string
 }
 
+func (e *ErrInvalidGeometryOrderRequest) Error() string { return e.Message }
+
 const GEOMETRY_DEFAULT_QUALITY = 80
 const GEOMETRY_MAX_QUALITY = 100
 const GEOMETRY_MIN_QUALITY = 0
 
 type Geometry struct {
-	Width              int    `json:"width"`
-	Height             int    `json:"height"`
-	Quality            int    `json:"quality"`
-	NeedsAutoCrop      bool   `json:"needs_auto_crop"`
-	NeedsManualCrop    bool   `json:"needs_manual_crop"`
-	CropWidthOffset    int    `json:"cropWidthOffset"`
-	CropHeightOffset   int    `json:"cropHeightOffset"`
-	CropWidth          int    `json:"cropWidth"`
-	CropHeight         int    `json:"cropHeight"`
-	AssumptionWidth    int    `json:"assumptionWidth"`
-	NeedsOriginalImage bool   `json:"needs_original_image"`
-	MiddleImageSize    string `json:"middle_image_size"`
+	Width              int     `json:"width"`
+	Height             int     `json:"height"`
+	DPR                float64 `json:"dpr"`
+	Quality            int     `json:"quality"`
+	NeedsAutoCrop      bool    `json:"needs_auto_crop"`
+	NeedsSmartCrop     bool    `json:"needs_smart_crop"`
+	Gravity            string  `json:"gravity"`
+	Fit                string  `json:"fit"`
+	Background         string  `json:"background"`
+	Rotate             int     `json:"rotate"`
+	Flip               string  `json:"flip"`
+	NeedsManualCrop    bool    `json:"needs_manual_crop"`
+	CropWidthOffset    int     `json:"cropWidthOffset"`
+	CropHeightOffset   int     `json:"cropHeightOffset"`
+	CropWidth          int     `json:"cropWidth"`
+	CropHeight         int     `json:"cropHeight"`
+	AssumptionWidth    int     `json:"assumptionWidth"`
+	NeedsOriginalImage bool    `json:"needs_original_image"`
+	MiddleImageSize    string  `json:"middle_image_size"`
 }
 
 type ErrInvalidGeometry struct {
@@ -47,8 +59,14 @@ const (
 	GEO_NONE = iota
 	GEO_WIDTH
 	GEO_HEIGHT
+	GEO_DPR
 	GEO_QUALITY
 	GEO_AUTO_CROP
+	GEO_GRAVITY
+	GEO_FIT
+	GEO_BACKGROUND
+	GEO_ROTATE
+	GEO_FLIP
 	GEO_MANUAL_CROP
 	GEO_WIDTH_OFFSET
 	GEO_HEIGHT_OFFSET
@@ -61,15 +79,64 @@ const (
 
 var (
 	MiddleImageSizes = []string{"original", "1000", "2000", "3000"}
+
+	geometryKeyOrder = map[string]int{
+		"w":    GEO_WIDTH,
+		"h":    GEO_HEIGHT,
+		"dpr":  GEO_DPR,
+		"q":    GEO_QUALITY,
+		"c":    GEO_AUTO_CROP,
+		"g":    GEO_GRAVITY,
+		"fit":  GEO_FIT,
+		"bg":   GEO_BACKGROUND,
+		"r":    GEO_ROTATE,
+		"flip": GEO_FLIP,
+		"mc":   GEO_MANUAL_CROP,
+		"wo":   GEO_WIDTH_OFFSET,
+		"ho":   GEO_HEIGHT_OFFSET,
+		"cw":   GEO_CROP_WIDTH,
+		"ch":   GEO_CROP_HEIGHT,
+		"aw":   GEO_ASSUMPTION_WIDTH,
+		"o":    GEO_ORIGINAL,
+		"m":    GEO_MIDDLE,
+	}
 )
 
+func parseGeometryNumber(key string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ErrInvalidGeometry{Message: "geometry " + key + " is must be numeric."}
+	}
+	if n < 0 {
+		return 0, &ErrInvalidGeometry{Message: "geometry " + key + " must not be negative."}
+	}
+	return n, nil
+}
+
+// ParseGeometryInAnyOrder parses geometry with keys in any order, duplicated keys are still invalid.
+func ParseGeometryInAnyOrder(geo string) (*Geometry, error) {
+	conditions := strings.Split(geo, ",")
+	order := func(condition string) int {
+		if pos, ok := geometryKeyOrder[strings.Split(condition, "=")[0]]; ok {
+			return pos
+		}
+		// unknown keys are ignored by ParseGeometry.
+		return GEO_MIDDLE + 1
+	}
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return order(conditions[i]) < order(conditions[j])
+	})
+	return ParseGeometry(strings.Join(conditions, ","))
+}
+
 func ParseGeometry(geo string) (*Geometry, error) {
 	conditions := strings.Split(geo, ",")
 
-	var width, height, quality int
-	var middleImageSize = ""
+	var width, height, quality, rotate int
+	var dpr float64
+	var middleImageSize, gravity, fit, background, flip = "", "", "", "", ""
 	var pos = GEO_NONE
-	var needsAutoCrop, needsManualCrop, needsOriginal bool
+	var needsAutoCrop, needsSmartCrop, needsManualCrop, needsOriginal bool
 	var cropWidthOffset, cropHeightOffset, cropWidth, cropHeight, assumptionWidth int
 	for _, condition := range conditions {
 		cond := strings.Split(condition, "=")
@@ -84,8 +151,8 @@ func ParseGeometry(geo string) (*Geometry, error) {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry w must be fixed order."}
 			}
 			pos = GEO_WIDTH
-			if w, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry w is must be numeric."}
+			if w, err := parseGeometryNumber("w", cond[1]); err != nil {
+				return nil, err
 			} else {
 				width = w
 			}
@@ -94,18 +161,28 @@ func ParseGeometry(geo string) (*Geometry, error) {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry h must be fixed order."}
 			}
 			pos = GEO_HEIGHT
-			if h, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry h is must be numeric."}
+			if h, err := parseGeometryNumber("h", cond[1]); err != nil {
+				return nil, err
 			} else {
 				height = h
 			}
+		case "dpr":
+			if pos >= GEO_DPR {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry dpr must be fixed order."}
+			}
+			pos = GEO_DPR
+			if d, err := parseDPR(cond[1]); err != nil {
+				return nil, err
+			} else {
+				dpr = d
+			}
 		case "q":
 			if pos >= GEO_QUALITY {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry q must be fixed order."}
 			}
 			pos = GEO_QUALITY
-			if q, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry q is must be numeric."}
+			if q, err := parseGeometryNumber("q", cond[1]); err != nil {
+				return nil, err
 			} else if q > GEOMETRY_MAX_QUALITY || q < GEOMETRY_MIN_QUALITY {
 				return nil, &ErrInvalidGeometry{Message: "q is under " + strconv.Itoa(GEOMETRY_MAX_QUALITY) + " and over " + strconv.Itoa(GEOMETRY_MIN_QUALITY)}
 			} else {
@@ -118,8 +195,62 @@ func ParseGeometry(geo string) (*Geometry, error) {
 			pos = GEO_AUTO_CROP
 			if cond[1] == "true" {
 				needsAutoCrop = true
+			} else if cond[1] == "smart" {
+				needsAutoCrop, needsSmartCrop = true, true
+			} else {
+				return nil, &ErrInvalidGeometry{Message: "geometry c must be true or smart."}
+			}
+		case "g":
+			if pos >= GEO_GRAVITY {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry g must be fixed order."}
+			}
+			pos = GEO_GRAVITY
+			if IsValidGravity(cond[1]) {
+				gravity = cond[1]
+			} else {
+				return nil, &ErrInvalidGeometry{Message: "geometry g must be one of " + strings.Join(gravityNames(), ", ") + "."}
+			}
+		case "fit":
+			if pos >= GEO_FIT {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry fit must be fixed order."}
+			}
+			pos = GEO_FIT
+			if IsValidFit(cond[1]) {
+				fit = cond[1]
+			} else {
+				return nil, &ErrInvalidGeometry{Message: "geometry fit must be one of " + strings.Join(FitModes, ", ") + "."}
+			}
+		case "bg":
+			if pos >= GEO_BACKGROUND {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry bg must be fixed order."}
+			}
+			pos = GEO_BACKGROUND
+			if _, err := ParseBackground(cond[1]); err == nil && len(cond[1]) != 0 {
+				background = normalizeBackground(cond[1])
+			} else {
+				return nil, &ErrInvalidGeometry{Message: "geometry bg must be rrggbb hex color."}
+			}
+		case "r":
+			if pos >= GEO_ROTATE {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry r must be fixed order."}
+			}
+			pos = GEO_ROTATE
+			if r, err := parseGeometryNumber("r", cond[1]); err != nil {
+				return nil, err
+			} else if !engine.IsValidRotation(r) {
+				return nil, &ErrInvalidGeometry{Message: "geometry r must be 90, 180 or 270."}
+			} else {
+				rotate = r
+			}
+		case "flip":
+			if pos >= GEO_FLIP {
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry flip must be fixed order."}
+			}
+			pos = GEO_FLIP
+			if IsValidFlip(cond[1]) {
+				flip = cond[1]
 			} else {
-				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry c must be true or manual."}
+				return nil, &ErrInvalidGeometry{Message: "geometry flip must be h or v."}
 			}
 		case "mc":
 			if pos >= GEO_MANUAL_CROP {
@@ -129,15 +260,15 @@ func ParseGeometry(geo string) (*Geometry, error) {
 			if cond[1] == "true" {
 				needsManualCrop = true
 			} else {
-				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry mc must be true or manual."}
+				return nil, &ErrInvalidGeometry{Message: "geometry mc must be true."}
 			}
 		case "wo":
 			if pos >= GEO_WIDTH_OFFSET {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry wo must be fixed order."}
 			}
 			pos = GEO_WIDTH_OFFSET
-			if wo, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry wo is must be numeric."}
+			if wo, err := parseGeometryNumber("wo", cond[1]); err != nil {
+				return nil, err
 			} else {
 				cropWidthOffset = wo
 			}
@@ -146,8 +277,8 @@ func ParseGeometry(geo string) (*Geometry, error) {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry ho must be fixed order."}
 			}
 			pos = GEO_HEIGHT_OFFSET
-			if ho, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry ho is must be numeric."}
+			if ho, err := parseGeometryNumber("ho", cond[1]); err != nil {
+				return nil, err
 			} else {
 				cropHeightOffset = ho
 			}
@@ -156,8 +287,8 @@ func ParseGeometry(geo string) (*Geometry, error) {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry cw must be fixed order."}
 			}
 			pos = GEO_CROP_WIDTH
-			if cw, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry cw is must be numeric."}
+			if cw, err := parseGeometryNumber("cw", cond[1]); err != nil {
+				return nil, err
 			} else {
 				cropWidth = cw
 			}
@@ -166,18 +297,18 @@ func ParseGeometry(geo string) (*Geometry, error) {
 				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry ch must be fixed order."}
 			}
 			pos = GEO_CROP_HEIGHT
-			if ch, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry ch is must be numeric."}
+			if ch, err := parseGeometryNumber("ch", cond[1]); err != nil {
+				return nil, err
 			} else {
 				cropHeight = ch
 			}
 		case "aw":
 			if pos >= GEO_ASSUMPTION_WIDTH {
-				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry as must be fixed order."}
+				return nil, &ErrInvalidGeometryOrderRequest{Message: "geometry aw must be fixed order."}
 			}
 			pos = GEO_ASSUMPTION_WIDTH
-			if aw, err := strconv.Atoi(cond[1]); err != nil {
-				return nil, &ErrInvalidGeometry{Message: "geometry as is must be numeric."}
+			if aw, err := parseGeometryNumber("aw", cond[1]); err != nil {
+				return nil, err
 			} else {
 				assumptionWidth = aw
 			}
@@ -216,14 +347,45 @@ func ParseGeometry(geo string) (*Geometry, error) {
 		return nil, &ErrInvalidGeometry{Message: "must specify width or height when not original mode."}
 	}
 
+	if dpr != 0 && width == 0 && height == 0 {
+		return nil, &ErrInvalidGeometry{Message: "must specify width or height when dpr is specified."}
+	}
+
+	if (rotate != 0 || len(flip) != 0) && width == 0 && height == 0 {
+		return nil, &ErrInvalidGeometry{Message: "must specify width or height when r or flip is specified."}
+	}
+
+	if len(fit) != 0 && (needsAutoCrop || needsManualCrop) {
+		return nil, &ErrInvalidGeometry{Message: "fit can not be specified with c or mc."}
+	}
+
+	if len(fit) != 0 && fit != FIT_INSIDE && (width == 0 || height == 0) {
+		return nil, &ErrInvalidGeometry{Message: "must specify width and height when fit=" + fit + "."}
+	}
+
+	if len(background) != 0 && fit != FIT_CONTAIN {
+		return nil, &ErrInvalidGeometry{Message: "must specify fit=contain when bg is specified."}
+	}
+
+	if len(gravity) != 0 && !(needsAutoCrop && !needsSmartCrop || fit == FIT_COVER || fit == FIT_CONTAIN) {
+		return nil, &ErrInvalidGeometry{Message: "must specify c=true, fit=cover or fit=contain when gravity is specified."}
+	}
+
 	if needsManualCrop && (cropWidth == 0 || cropHeight == 0 || assumptionWidth == 0) {
 		return nil, &ErrInvalidGeometry{Message: "must specify crop width, crop height and assumption width when manual crop mode."}
 	}
 
 	return &Geometry{
 		Width: width, Height: height,
+		DPR:                dpr,
 		Quality:            quality,
 		NeedsAutoCrop:      needsAutoCrop,
+		NeedsSmartCrop:     needsSmartCrop,
+		Gravity:            gravity,
+		Fit:                fit,
+		Background:         background,
+		Rotate:             rotate,
+		Flip:               flip,
 		NeedsManualCrop:    needsManualCrop,
 		CropWidthOffset:    cropWidthOffset,
 		CropHeightOffset:   cropHeightOffset,
@@ -252,6 +414,12 @@ func (g *Geometry) ToResizeOption() (resizeOption *ResizeOption) {
 		Height:           g.Height,
 		Quality:          g.Quality,
 		NeedsAutoCrop:    g.NeedsAutoCrop,
+		NeedsSmartCrop:   g.NeedsSmartCrop,
+		Gravity:          g.Gravity,
+		Fit:              g.Fit,
+		Background:       g.Background,
+		Rotate:           g.Rotate,
+		Flip:             g.Flip,
 		NeedsManualCrop:  g.NeedsManualCrop,
 		CropWidthOffset:  g.CropWidthOffset,
 		CropHeightOffset: g.CropHeightOffset,
@@ -261,6 +429,53 @@ func (g *Geometry) ToResizeOption() (resizeOption *ResizeOption) {
 	}
 }
 
+// Canonical returns the geometry string with keys in the fixed order and without default values,
+// equivalent geometries have the same canonical string.
+func (g *Geometry) Canonical() string {
+	conditions := make([]string, 0)
+	number := func(key string, value int) {
+		if value != 0 {
+			conditions = append(conditions, key+"="+strconv.Itoa(value))
+		}
+	}
+	flag := func(key string, value bool) {
+		if value {
+			conditions = append(conditions, key+"=true")
+		}
+	}
+	text := func(key string, value string) {
+		if len(value) != 0 {
+			conditions = append(conditions, key+"="+value)
+		}
+	}
+
+	number("w", g.Width)
+	number("h", g.Height)
+	if g.DPR != 0 {
+		conditions = append(conditions, "dpr="+formatDPR(g.DPR))
+	}
+	number("q", g.Quality)
+	if g.NeedsSmartCrop {
+		conditions = append(conditions, "c=smart")
+	} else {
+		flag("c", g.NeedsAutoCrop)
+	}
+	text("g", g.Gravity)
+	text("fit", g.Fit)
+	text("bg", g.Background)
+	number("r", g.Rotate)
+	text("flip", g.Flip)
+	flag("mc", g.NeedsManualCrop)
+	number("wo", g.CropWidthOffset)
+	number("ho", g.CropHeightOffset)
+	number("cw", g.CropWidth)
+	number("ch", g.CropHeight)
+	number("aw", g.AssumptionWidth)
+	flag("o", g.NeedsOriginalImage)
+	text("m", g.MiddleImageSize)
+	return strings.Join(conditions, ",")
+}
+
 func (g *Geometry) ToString() string {
-	return fmt.Sprintf("Width: %d, Height: %d, Quality: %d, NeedsAutoCrop: %t, NeedsManualCrop: %t, NeedsOriginalImage: %t", g.Width, g.Height, g.Quality, g.NeedsAutoCrop, g.NeedsManualCrop, g.NeedsOriginalImage)
+	return fmt.Sprintf("Width: %d, Height: %d, DPR: %g, Quality: %d, NeedsAutoCrop: %t, NeedsSmartCrop: %t, Gravity: %s, Fit: %s, Rotate: %d, Flip: %s, NeedsManualCrop: %t, NeedsOriginalImage: %t", g.Width, g.Height, g.DPR, g.Quality, g.NeedsAutoCrop, g.NeedsSmartCrop, g.Gravity, g.Fit, g.Rotate, g.Flip, g.NeedsManualCrop, g.NeedsOriginalImage)
 }
@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package resizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func FuzzParseGeometry(f *testing.F) {
+	for _, seed := range []string{
+		"w=100",
+		"w=280,h=300,q=85",
+		"w=280,h=300,dpr=2.5",
+		"w=280,h=300,c=true",
+		"w=100,h=100,mc=true,wo=10,ho=20,cw=300,ch=300,aw=1000",
+		"o=true",
+		"m=true",
+		"h=100,w=100",
+		"w=abc",
+		"",
+		",,,",
+		"w==",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, geo string) {
+		g, err := ParseGeometry(geo)
+		if err != nil {
+			if !isInvalidGeometry(err) && !isInvalidGeometryOrder(err) {
+				t.Fatalf("%q: unexpected error type %#v", geo, err)
+			}
+			if len(err.Error()) == 0 {
+				t.Fatalf("%q: empty error message", geo)
+			}
+			return
+		}
+
+		canonical := g.Canonical()
+		got, err := ParseGeometry(canonical)
+		if err != nil {
+			t.Fatalf("%q: canonical %q is rejected, %s", geo, canonical, err)
+		}
+		if !reflect.DeepEqual(got, g) {
+			t.Fatalf("%q: canonical %q is parsed to %+v, want %+v", geo, canonical, *got, *g)
+		}
+	})
+}
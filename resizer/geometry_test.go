@@ -0,0 +1,306 @@
+package resizer
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tokubai/kinu/engine"
+)
+
+func isInvalidGeometry(err error) bool {
+	_, ok := err.(*ErrInvalidGeometry)
+	return ok
+}
+
+func isInvalidGeometryOrder(err error) bool {
+	_, ok := err.(*ErrInvalidGeometryOrderRequest)
+	return ok
+}
+
+func TestParseGeometry(t *testing.T) {
+	cases := []struct {
+		geometry string
+		want     Geometry
+	}{
+		{"w=100", Geometry{Width: 100}},
+		{"h=100", Geometry{Height: 100}},
+		{"w=280,h=300,q=85", Geometry{Width: 280, Height: 300, Quality: 85}},
+		{"w=280,h=300,dpr=2,q=85", Geometry{Width: 280, Height: 300, DPR: 2, Quality: 85}},
+		{"w=280,dpr=1.5", Geometry{Width: 280, DPR: 1.5}},
+		{"h=300,dpr=2.625", Geometry{Height: 300, DPR: 2.63}},
+		{"w=280,dpr=1", Geometry{Width: 280}},
+		{"w=280,h=300,c=true", Geometry{Width: 280, Height: 300, NeedsAutoCrop: true}},
+		{"w=280,h=300,c=true,g=north", Geometry{Width: 280, Height: 300, NeedsAutoCrop: true, Gravity: "north"}},
+		{"w=280,h=300,c=smart", Geometry{Width: 280, Height: 300, NeedsAutoCrop: true, NeedsSmartCrop: true}},
+		{"w=300,h=250,fit=contain", Geometry{Width: 300, Height: 250, Fit: "contain"}},
+		{"w=300,h=250,g=south,fit=contain,bg=FF0000", Geometry{Width: 300, Height: 250, Gravity: "south", Fit: "contain", Background: "ff0000"}},
+		{"w=300,h=250,fit=contain,bg=ffffff", Geometry{Width: 300, Height: 250, Fit: "contain"}},
+		{"w=300,fit=inside", Geometry{Width: 300, Fit: "inside"}},
+		{"w=300,h=250,fit=fill", Geometry{Width: 300, Height: 250, Fit: "fill"}},
+		{"w=300,r=90", Geometry{Width: 300, Rotate: 90}},
+		{"w=300,h=250,c=true,r=270,flip=h", Geometry{Width: 300, Height: 250, NeedsAutoCrop: true, Rotate: 270, Flip: "h"}},
+		{"h=250,flip=v", Geometry{Height: 250, Flip: "v"}},
+		{"w=280,h=300,c=true,g=center", Geometry{Width: 280, Height: 300, NeedsAutoCrop: true, Gravity: "center"}},
+		{"w=100,h=100,mc=true,wo=10,ho=20,cw=300,ch=300,aw=1000", Geometry{Width: 100, Height: 100, NeedsManualCrop: true, CropWidthOffset: 10, CropHeightOffset: 20, CropWidth: 300, CropHeight: 300, AssumptionWidth: 1000}},
+		{"o=true", Geometry{NeedsOriginalImage: true}},
+		{"w=100,o=false", Geometry{Width: 100}},
+		{"m=true", Geometry{MiddleImageSize: "1000"}},
+		{"m=2000", Geometry{MiddleImageSize: "2000"}},
+		{"w=100,h=0", Geometry{Width: 100}},
+		{"w=100,unknown=1", Geometry{Width: 100}},
+	}
+
+	for _, c := range cases {
+		got, err := ParseGeometry(c.geometry)
+		if err != nil {
+			t.Errorf("%s: %s", c.geometry, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.geometry, *got, c.want)
+		}
+	}
+}
+
+func TestParseGeometryErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"w",
+		"w=",
+		"w=abc",
+		"w=-1",
+		"w=1.5",
+		"h=99999999999999999999",
+		"q=101",
+		"q=-1",
+		"w=100,c=false",
+		"w=100,mc=yes",
+		"w=100,h=100,mc=true,cw=100,ch=100",
+		"w=100,h=100,mc=true,wo=-1,cw=100,ch=100,aw=100",
+		"m=500",
+		"q=80",
+		"c=true",
+		"o=false",
+		"w=100,,h=100",
+		"w=100,h=100,c=true,g=top",
+		"w=100,h=100,g=north",
+		"w=100,h=100,c=smart,g=north",
+		"w=100,h=100,c=clever",
+		"w=100,h=100,fit=stretch",
+		"w=100,fit=contain",
+		"w=100,h=100,c=true,fit=cover",
+		"w=100,h=100,fit=fill,bg=000000",
+		"w=100,h=100,fit=contain,bg=fff",
+		"w=100,h=100,fit=contain,bg=zzzzzz",
+		"w=100,h=100,g=north,fit=fill",
+		"w=100,dpr=0.5",
+		"w=100,dpr=5",
+		"w=100,dpr=two",
+		"w=100,dpr=NaN",
+		"dpr=2,m=1000",
+		"w=100,r=45",
+		"w=100,r=0",
+		"w=100,r=-90",
+		"w=100,flip=x",
+		"r=90,o=true",
+		"flip=h,m=1000",
+	}
+	for _, geometry := range invalid {
+		_, err := ParseGeometry(geometry)
+		if !isInvalidGeometry(err) {
+			t.Errorf("%s: got %#v, want ErrInvalidGeometry", geometry, err)
+		}
+	}
+
+	misordered := []string{
+		"h=100,w=100",
+		"w=100,w=200",
+		"q=80,h=100",
+		"w=100,c=true,q=80",
+		"w=100,h=100,mc=true,ho=10,wo=10,cw=100,ch=100,aw=100",
+		"m=true,o=true",
+		"w=100,mc=true,c=true",
+		"w=100,g=north,c=true",
+		"w=100,h=100,bg=000000,fit=contain",
+		"w=100,q=80,dpr=2",
+		"w=100,flip=h,r=90",
+		"w=100,h=100,mc=true,r=90,cw=100,ch=100,aw=100",
+	}
+	for _, geometry := range misordered {
+		_, err := ParseGeometry(geometry)
+		if !isInvalidGeometryOrder(err) {
+			t.Errorf("%s: got %#v, want ErrInvalidGeometryOrderRequest", geometry, err)
+		}
+	}
+}
+
+func randomGeometry(r *rand.Rand) *Geometry {
+	g := &Geometry{}
+	switch r.Intn(4) {
+	case 0:
+		g.Width = 1 + r.Intn(3000)
+	case 1:
+		g.Height = 1 + r.Intn(3000)
+	case 2:
+		g.Width, g.Height = 1+r.Intn(3000), 1+r.Intn(3000)
+	default:
+		if r.Intn(2) == 0 {
+			g.NeedsOriginalImage = true
+		} else {
+			g.MiddleImageSize = MiddleImageSizes[r.Intn(len(MiddleImageSizes))]
+		}
+	}
+	if (g.Width != 0 || g.Height != 0) && r.Intn(3) == 0 {
+		g.DPR = float64(101+r.Intn(300)) / 100
+	}
+	if r.Intn(2) == 0 {
+		g.Quality = r.Intn(GEOMETRY_MAX_QUALITY + 1)
+	}
+	g.NeedsAutoCrop = r.Intn(3) == 0
+	if g.NeedsAutoCrop && r.Intn(3) == 0 {
+		g.NeedsSmartCrop = true
+	} else if g.NeedsAutoCrop && r.Intn(2) == 0 {
+		names := gravityNames()
+		g.Gravity = names[r.Intn(len(names))]
+	}
+	if r.Intn(3) == 0 {
+		g.NeedsManualCrop = true
+		g.CropWidthOffset, g.CropHeightOffset = r.Intn(500), r.Intn(500)
+		g.CropWidth, g.CropHeight, g.AssumptionWidth = 1+r.Intn(1000), 1+r.Intn(1000), 1+r.Intn(1000)
+	}
+	if !g.NeedsAutoCrop && !g.NeedsManualCrop && g.Width != 0 && g.Height != 0 && r.Intn(3) == 0 {
+		g.Fit = FitModes[r.Intn(len(FitModes))]
+		if g.Fit == FIT_CONTAIN && r.Intn(2) == 0 {
+			g.Background = "336699"
+		}
+		if (g.Fit == FIT_CONTAIN || g.Fit == FIT_COVER) && r.Intn(2) == 0 {
+			g.Gravity = "north"
+		}
+	}
+	if (g.Width != 0 || g.Height != 0) && r.Intn(3) == 0 {
+		g.Rotate = engine.Rotations[r.Intn(len(engine.Rotations))]
+	}
+	if (g.Width != 0 || g.Height != 0) && r.Intn(3) == 0 {
+		g.Flip = []string{FLIP_HORIZONTAL, FLIP_VERTICAL}[r.Intn(2)]
+	}
+	if r.Intn(4) == 0 {
+		g.NeedsOriginalImage = true
+	}
+	return g
+}
+
+func TestParseGeometryRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		want := randomGeometry(r)
+		serialized := want.Canonical()
+
+		got, err := ParseGeometry(serialized)
+		if err != nil {
+			t.Fatalf("%s: %s", serialized, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %+v, want %+v", serialized, *got, *want)
+		}
+		if got.Canonical() != serialized {
+			t.Fatalf("%s: serialized again to %s", serialized, got.Canonical())
+		}
+	}
+}
+
+func TestParseGeometryInAnyOrder(t *testing.T) {
+	cases := []struct {
+		geometry  string
+		canonical string
+	}{
+		{"w=100", "w=100"},
+		{"w=100,h=0", "w=100"},
+		{"h=300,w=280", "w=280,h=300"},
+		{"c=true,q=85,h=300,w=280", "w=280,h=300,q=85,c=true"},
+		{"q=85,dpr=2.0,w=280", "w=280,dpr=2,q=85"},
+		{"flip=h,r=90,w=280", "w=280,r=90,flip=h"},
+		{"aw=1000,ch=300,cw=300,ho=20,wo=10,mc=true,h=100,w=100", "w=100,h=100,mc=true,wo=10,ho=20,cw=300,ch=300,aw=1000"},
+		{"m=true,w=100", "w=100,m=1000"},
+		{"unknown=1,o=true", "o=true"},
+	}
+
+	for _, c := range cases {
+		got, err := ParseGeometryInAnyOrder(c.geometry)
+		if err != nil {
+			t.Errorf("%s: %s", c.geometry, err)
+			continue
+		}
+		if got.Canonical() != c.canonical {
+			t.Errorf("%s: canonical is %s, want %s", c.geometry, got.Canonical(), c.canonical)
+		}
+	}
+
+	for _, geometry := range []string{"w=100,w=200", "h=100,w=abc", "w=100,c=false"} {
+		if _, err := ParseGeometryInAnyOrder(geometry); err == nil {
+			t.Errorf("%s: parsed, want error", geometry)
+		}
+	}
+}
+
+func TestParseGeometryInAnyOrderProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		want := randomGeometry(r)
+		keys := strings.Split(want.Canonical(), ",")
+		r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		shuffled := strings.Join(keys, ",")
+
+		got, err := ParseGeometryInAnyOrder(shuffled)
+		if err != nil {
+			t.Fatalf("%s: %s", shuffled, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %+v, want %+v", shuffled, *got, *want)
+		}
+	}
+}
+
+func TestParseGeometryOrderProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		keys := strings.Split(randomGeometry(r).Canonical(), ",")
+		if len(keys) < 2 {
+			continue
+		}
+
+		// swapping any two keys breaks the fixed order.
+		a := r.Intn(len(keys) - 1)
+		b := a + 1 + r.Intn(len(keys)-a-1)
+		keys[a], keys[b] = keys[b], keys[a]
+		swapped := strings.Join(keys, ",")
+
+		_, err := ParseGeometry(swapped)
+		if !isInvalidGeometryOrder(err) {
+			t.Fatalf("%s: got %#v, want ErrInvalidGeometryOrderRequest", swapped, err)
+		}
+	}
+}
+
+func TestParseGeometryInvalidValueProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		keys := strings.Split(randomGeometry(r).Canonical(), ",")
+
+		// breaking a value of a key in the fixed order is always invalid geometry, not order error.
+		n := r.Intn(len(keys))
+		key := strings.Split(keys[n], "=")[0]
+		keys[n] = key + "=-x"
+		broken := strings.Join(keys, ",")
+
+		_, err := ParseGeometry(broken)
+		if key == "o" {
+			// o accepts any value as false.
+			continue
+		}
+		if !isInvalidGeometry(err) {
+			t.Fatalf("%s: got %#v, want ErrInvalidGeometry", broken, err)
+		}
+	}
+}
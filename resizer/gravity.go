@@ -0,0 +1,78 @@
+package resizer
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// FocalPoint is the position of the subject as ratios of the image width and height from the top left.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+var (
+	centerFocalPoint = FocalPoint{X: 0.5, Y: 0.5}
+
+	// gravities are focal points on the edges, the crop is aligned to the edge.
+	gravities = map[string]FocalPoint{
+		"center":    centerFocalPoint,
+		"north":     {X: 0.5, Y: 0},
+		"south":     {X: 0.5, Y: 1},
+		"east":      {X: 1, Y: 0.5},
+		"west":      {X: 0, Y: 0.5},
+		"northeast": {X: 1, Y: 0},
+		"northwest": {X: 0, Y: 0},
+		"southeast": {X: 1, Y: 1},
+		"southwest": {X: 0, Y: 1},
+	}
+)
+
+func IsValidGravity(gravity string) bool {
+	_, ok := gravities[gravity]
+	return ok
+}
+
+func gravityNames() []string {
+	names := make([]string, 0, len(gravities))
+	for name := range gravities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFocalPoint parses ratios between 0 and 1, nil is returned when both are empty.
+func ParseFocalPoint(x string, y string) (*FocalPoint, error) {
+	if len(x) == 0 && len(y) == 0 {
+		return nil, nil
+	}
+	if len(x) == 0 || len(y) == 0 {
+		return nil, &ErrInvalidOption{Message: "focal point must specify both fx and fy"}
+	}
+
+	// NaN is not ordered, so it is rejected explicitly.
+	fx, err := strconv.ParseFloat(x, 64)
+	if err != nil || math.IsNaN(fx) || fx < 0 || fx > 1 {
+		return nil, &ErrInvalidOption{Message: "fx must be between 0 and 1"}
+	}
+	fy, err := strconv.ParseFloat(y, 64)
+	if err != nil || math.IsNaN(fy) || fy < 0 || fy > 1 {
+		return nil, &ErrInvalidOption{Message: "fy must be between 0 and 1"}
+	}
+
+	return &FocalPoint{X: fx, Y: fy}, nil
+}
+
+// cropOffset places the crop centered on the ratio of the resized length, and keeps it inside the image.
+func cropOffset(ratio float64, resizeLength int, cropLength int) int {
+	offset := int(math.Floor(ratio*float64(resizeLength) - float64(cropLength)/2))
+	if offset > resizeLength-cropLength {
+		offset = resizeLength - cropLength
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return offset
+}
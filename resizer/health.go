@@ -0,0 +1,44 @@
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+var (
+	ErrEmptyResizedImage = errors.New("resized image is empty")
+)
+
+// healthCheckImage is a tiny png decoded and resized by the engine in readiness checks.
+var healthCheckImage = func() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 64), G: uint8(y * 64), B: 128, A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	return buf.Bytes()
+}()
+
+// CheckEngine resizes the built-in image directly, without waiting in the worker queue.
+func CheckEngine() error {
+	result := Resize(context.Background(), healthCheckImage, &ResizeOption{
+		Width:             2,
+		Height:            2,
+		SourceContentType: "image/png",
+		Format:            "jpg",
+	})
+	if result.err != nil {
+		return result.err
+	}
+	if len(result.image) == 0 {
+		return ErrEmptyResizedImage
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package resizer
+
+import (
+	"github.com/tokubai/kinu/engine"
+)
+
+// Rotation and flip are applied to the upright image after the EXIF orientation and before resizing,
+// so that the width, height and crop of the geometry are of the rotated image.
+const (
+	FLIP_HORIZONTAL = "h"
+	FLIP_VERTICAL   = "v"
+)
+
+// IsValidRotation is true for degrees accepted by Rotate of the resize engine.
+func IsValidRotation(degrees int) bool {
+	return engine.IsValidRotation(degrees)
+}
+
+func IsValidFlip(flip string) bool {
+	return flip == FLIP_HORIZONTAL || flip == FLIP_VERTICAL
+}
+
+// RotatesSize is true when the rotation swaps the width and height of the image.
+func RotatesSize(degrees int) bool {
+	return degrees == 90 || degrees == 270
+}
+
+func (o *ResizeOption) NeedsTransform() bool {
+	return o.Rotate != 0 || len(o.Flip) != 0
+}
+
+// transform rotates the opened image, then flips it.
+func transform(e engine.ResizeEngine, option *ResizeOption) error {
+	if option.Rotate != 0 {
+		err := e.Rotate(option.Rotate)
+		if err != nil {
+			return err
+		}
+	}
+	if len(option.Flip) != 0 {
+		return e.Flip(option.Flip == FLIP_HORIZONTAL)
+	}
+	return nil
+}
+
+// transformFocalPoint moves the focal point of the stored image along with its pixels.
+func transformFocalPoint(focalPoint *FocalPoint, degrees int, flip string) *FocalPoint {
+	x, y := focalPoint.X, focalPoint.Y
+	switch degrees {
+	case 90:
+		x, y = 1-y, x
+	case 180:
+		x, y = 1-x, 1-y
+	case 270:
+		x, y = y, 1-x
+	}
+	switch flip {
+	case FLIP_HORIZONTAL:
+		x = 1 - x
+	case FLIP_VERTICAL:
+		y = 1 - y
+	}
+	return &FocalPoint{X: x, Y: y}
+}
@@ -0,0 +1,163 @@
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// exifOrientedJpeg encodes the stored image as jpeg with the EXIF orientation.
+func exifOrientedJpeg(t *testing.T, img image.Image, orientation int) []byte {
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	for _, v := range []interface{}{uint16(42), uint32(8), uint16(1), uint16(0x0112), uint16(3), uint32(1), uint16(orientation), uint16(0), uint32(0)} {
+		binary.Write(tiff, binary.BigEndian, v)
+	}
+	exif := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := &bytes.Buffer{}
+	out.Write(buf.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(len(exif)+2))
+	out.Write(exif)
+	out.Write(buf.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestResizeExifOriented(t *testing.T) {
+	// stored 400x300 and rotated by the EXIF orientation, the image is 300x400 upright.
+	blob := exifOrientedJpeg(t, subjectImage(400, 300, 200, 150, 10), 6)
+
+	cases := []struct {
+		geometry      string
+		width, height int
+	}{
+		{"w=150", 150, 200},
+		{"w=300,h=100", 75, 100},
+		{"w=300,h=100,c=true", 300, 100},
+		{"w=300,h=100,fit=contain", 300, 100},
+		{"w=300,h=100,fit=fill", 300, 100},
+		{"w=300,h=100,fit=outside", 300, 400},
+		{"w=300,h=100,r=90", 133, 100},
+	}
+
+	for _, c := range cases {
+		geometry, err := ParseGeometry(c.geometry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stored size is upright, except originals stored before it was.
+		for _, hint := range [][2]int{{300, 400}, {400, 300}} {
+			option := geometry.ToResizeOption()
+			option.SizeHintWidth, option.SizeHintHeight = hint[0], hint[1]
+
+			result := Resize(context.Background(), blob, option)
+			if result.err != nil {
+				t.Errorf("%s: %s", c.geometry, result.err)
+				continue
+			}
+			config, _, err := image.DecodeConfig(bytes.NewReader(result.image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != c.width || config.Height != c.height {
+				t.Errorf("%s with size hint %v: got %dx%d, want %dx%d", c.geometry, hint, config.Width, config.Height, c.width, c.height)
+			}
+		}
+	}
+}
+
+func TestTransformFocalPoint(t *testing.T) {
+	cases := []struct {
+		degrees int
+		flip    string
+		want    FocalPoint
+	}{
+		{0, "", FocalPoint{X: 0.2, Y: 0.1}},
+		{90, "", FocalPoint{X: 0.9, Y: 0.2}},
+		{180, "", FocalPoint{X: 0.8, Y: 0.9}},
+		{270, "", FocalPoint{X: 0.1, Y: 0.8}},
+		{0, "h", FocalPoint{X: 0.8, Y: 0.1}},
+		{0, "v", FocalPoint{X: 0.2, Y: 0.9}},
+		{90, "h", FocalPoint{X: 0.1, Y: 0.2}},
+	}
+
+	for _, c := range cases {
+		got := transformFocalPoint(&FocalPoint{X: 0.2, Y: 0.1}, c.degrees, c.flip)
+		if math.Abs(got.X-c.want.X) > 1e-9 || math.Abs(got.Y-c.want.Y) > 1e-9 {
+			t.Errorf("r=%d flip=%s: got %+v, want %+v", c.degrees, c.flip, *got, c.want)
+		}
+	}
+}
+
+func TestResizeRotateFocalPoint(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, subjectImage(600, 300, 80, 150, 60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the subject on the left of the landscape is on the top after rotating 90 degrees.
+	option := &ResizeOption{Width: 100, Height: 100, NeedsAutoCrop: true, Rotate: 90, Format: "png",
+		FocalPoint: &FocalPoint{X: 80.0 / 600, Y: 0.5}}
+	result := Resize(context.Background(), buf.Bytes(), option)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(result.image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 100 {
+		t.Fatalf("got %v", img.Bounds())
+	}
+	// the subject at y=80 of 600 is at y=26 of the resized 100x200, out of the centered crop.
+	if r, _, _, _ := img.At(50, 26).RGBA(); r>>8 < 200 {
+		t.Errorf("subject is cropped out, got %v at (50, 26)", img.At(50, 26))
+	}
+}
+
+func TestResizeExifOrientedFocalPoint(t *testing.T) {
+	// the subject on the right of the stored 400x300 is at the bottom of the upright 300x400.
+	blob := exifOrientedJpeg(t, subjectImage(400, 300, 350, 150, 60), 6)
+
+	for _, geometry := range []string{"w=100,h=100,c=true,g=south", "w=100,h=100,c=true"} {
+		option, err := ParseGeometry(geometry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resizeOption := option.ToResizeOption()
+		resizeOption.Format = "png"
+		if resizeOption.Gravity == "" {
+			resizeOption.FocalPoint = &FocalPoint{X: 0.5, Y: 0.875}
+		}
+
+		result := Resize(context.Background(), blob, resizeOption)
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		img, err := png.Decode(bytes.NewReader(result.image))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 100 {
+			t.Fatalf("%s: got %v", geometry, img.Bounds())
+		}
+		// the subject at y=350 of 400 is at y=116 of the resized 100x133, and y=83 of the crop at the bottom.
+		if r, _, _, _ := img.At(50, 83).RGBA(); r>>8 < 200 {
+			t.Errorf("%s: subject is cropped out, got %v at (50, 83)", geometry, img.At(50, 83))
+		}
+	}
+}
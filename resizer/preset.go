@@ -0,0 +1,129 @@
+package resizer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+// GeometryPreset is a named geometry configured server-side, it is requested as `p=name` or `preset=name`.
+type GeometryPreset struct {
+	Geometry string `json:"geometry"`
+
+	// when not empty, the preset is only available for these image categories.
+	Categories []string `json:"categories"`
+
+	geometry *Geometry
+}
+
+// GeometryPresetConfig is the format of the file of KINU_GEOMETRY_PRESET_FILE.
+//
+//	{
+//	  "presets": {
+//	    "thumb": { "geometry": "w=280,h=300,c=true,q=85" },
+//	    "card_large": { "geometry": "w=640,h=480,c=true", "categories": ["foods"] }
+//	  },
+//	  "preset_only_categories": ["foods"]
+//	}
+type GeometryPresetConfig struct {
+	Presets map[string]*GeometryPreset `json:"presets"`
+
+	// image categories which refuse geometries other than presets.
+	PresetOnlyCategories []string `json:"preset_only_categories"`
+}
+
+var (
+	geometryPresets      = make(map[string]*GeometryPreset)
+	presetOnlyCategories = make(map[string]bool)
+)
+
+func init() {
+	path := os.Getenv("KINU_GEOMETRY_PRESET_FILE")
+	if len(path) == 0 {
+		return
+	}
+
+	err := LoadGeometryPresets(path)
+	if err != nil {
+		panic(err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"path":    path,
+		"presets": len(geometryPresets),
+	}).Info("load geometry presets")
+}
+
+// LoadGeometryPresets replaces the presets by the config file, all preset geometries are validated on load.
+func LoadGeometryPresets(path string) error {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	config := &GeometryPresetConfig{}
+	err = json.Unmarshal(blob, config)
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	presets := make(map[string]*GeometryPreset)
+	for name, preset := range config.Presets {
+		geometry, err := ParseGeometryInAnyOrder(preset.Geometry)
+		if err != nil {
+			return &ErrInvalidGeometry{Message: "preset " + name + " has invalid geometry, " + err.Error()}
+		}
+		preset.geometry = geometry
+		presets[name] = preset
+	}
+
+	categories := make(map[string]bool)
+	for _, category := range config.PresetOnlyCategories {
+		categories[category] = true
+	}
+
+	geometryPresets = presets
+	presetOnlyCategories = categories
+	return nil
+}
+
+// PresetName returns the preset name when the geometry is `p=name` or `preset=name`.
+func PresetName(geo string) (string, bool) {
+	cond := strings.Split(geo, "=")
+	if len(cond) != 2 || (cond[0] != "p" && cond[0] != "preset") {
+		return "", false
+	}
+	return cond[1], true
+}
+
+func IsPresetOnlyCategory(category string) bool {
+	return presetOnlyCategories[category]
+}
+
+// ParsePresetGeometry returns a copy of the preset geometry available for the category.
+func ParsePresetGeometry(category string, name string) (*Geometry, error) {
+	preset, ok := geometryPresets[name]
+	if !ok {
+		return nil, &ErrInvalidGeometry{Message: "preset " + name + " is not found."}
+	}
+
+	if len(preset.Categories) != 0 {
+		available := false
+		for _, c := range preset.Categories {
+			if c == category {
+				available = true
+				break
+			}
+		}
+		if !available {
+			return nil, &ErrInvalidGeometry{Message: "preset " + name + " is not available for " + category + "."}
+		}
+	}
+
+	geometry := *preset.geometry
+	return &geometry, nil
+}
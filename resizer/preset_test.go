@@ -0,0 +1,101 @@
+package resizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func loadTestPresets(t *testing.T, config string) error {
+	dir, err := ioutil.TempDir("", "kinu-preset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "presets.json")
+	err = ioutil.WriteFile(path, []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return LoadGeometryPresets(path)
+}
+
+func TestGeometryPresets(t *testing.T) {
+	defer func() {
+		geometryPresets = make(map[string]*GeometryPreset)
+		presetOnlyCategories = make(map[string]bool)
+	}()
+
+	err := loadTestPresets(t, `{
+		"presets": {
+			"thumb": { "geometry": "w=280,h=300,c=true,q=85" },
+			"card_large": { "geometry": "h=480,w=640", "categories": ["foods"] }
+		},
+		"preset_only_categories": ["foods"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, geo := range []string{"p=thumb", "preset=thumb"} {
+		name, ok := PresetName(geo)
+		if !ok || name != "thumb" {
+			t.Errorf("%s: got %s %v, want thumb", geo, name, ok)
+		}
+	}
+	for _, geo := range []string{"w=100", "p=thumb,w=100", "pp=thumb"} {
+		if _, ok := PresetName(geo); ok {
+			t.Errorf("%s: parsed as preset", geo)
+		}
+	}
+
+	thumb, err := ParsePresetGeometry("users", "thumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Geometry{Width: 280, Height: 300, Quality: 85, NeedsAutoCrop: true}
+	if !reflect.DeepEqual(thumb, want) {
+		t.Errorf("thumb: got %+v, want %+v", *thumb, *want)
+	}
+
+	// presets are copied, modifying a request must not change the preset.
+	thumb.Width = 1
+	thumb, _ = ParsePresetGeometry("users", "thumb")
+	if thumb.Width != 280 {
+		t.Errorf("thumb: preset is modified to %+v", *thumb)
+	}
+
+	if _, err := ParsePresetGeometry("foods", "card_large"); err != nil {
+		t.Errorf("card_large: %s", err)
+	}
+	if _, err := ParsePresetGeometry("users", "card_large"); !isInvalidGeometry(err) {
+		t.Errorf("card_large: got %#v for users, want ErrInvalidGeometry", err)
+	}
+	if _, err := ParsePresetGeometry("users", "unknown"); !isInvalidGeometry(err) {
+		t.Errorf("unknown: got %#v, want ErrInvalidGeometry", err)
+	}
+
+	if !IsPresetOnlyCategory("foods") || IsPresetOnlyCategory("users") {
+		t.Errorf("only foods must be preset only category")
+	}
+}
+
+func TestGeometryPresetsInvalidConfig(t *testing.T) {
+	defer func() {
+		geometryPresets = make(map[string]*GeometryPreset)
+		presetOnlyCategories = make(map[string]bool)
+	}()
+
+	for _, config := range []string{
+		`{`,
+		`{"presets": {"broken": {"geometry": "w=abc"}}}`,
+		`{"presets": {"empty": {"geometry": ""}}}`,
+	} {
+		if err := loadTestPresets(t, config); err == nil {
+			t.Errorf("%s: loaded, want error", config)
+		}
+	}
+}
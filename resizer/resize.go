@@ -1,77 +1,140 @@
 package resizer
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/engine"
 	"github.com/tokubai/kinu/logger"
 )
 
-func Resize(image []byte, option *ResizeOption) (result *ResizeResult) {
+// EngineType is the selected resize engine, resized images of the same geometry differ by the engine.
+func EngineType() string {
+	return engine.SelectedEngineType()
+}
+
+func Resize(ctx context.Context, image []byte, option *ResizeOption) (result *ResizeResult) {
 	calculator, err := NewCoodinatesCalculator(option)
 	if err != nil {
-		return &ResizeResult{err: logger.ErrorDebug(err)}
+		return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+	}
+
+	if option.NeedsSmartCrop && option.Width > 0 && option.Height > 0 {
+		focalPoint := option.SmartCropFocalPoint
+		if focalPoint == nil {
+			focalPoint, err = smartCropFocalPoint(ctx, image, option)
+			if err != nil {
+				return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+			}
+			if option.OnSmartCrop != nil {
+				option.OnSmartCrop(focalPoint)
+			}
+		}
+		calculator.Gravity, calculator.FocalPoint = "", focalPoint
+	} else if calculator.FocalPoint != nil && option.NeedsTransform() {
+		calculator.FocalPoint = transformFocalPoint(calculator.FocalPoint, option.Rotate, option.Flip)
 	}
 
 	engine, err := engine.New(image)
 	if err != nil {
-		return &ResizeResult{err: logger.ErrorDebug(err)}
+		return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 	}
 
+	// the size hint is of the stored image, which is upright but not rotated yet.
 	var coodinates *Coodinates
-	if option.HasSizeHint() && !option.NeedsManualCrop {
+	if option.HasSizeHint() && !option.NeedsManualCrop && !option.NeedsTransform() {
 		calculator.SetImageSize(option.SizeHintWidth, option.SizeHintHeight)
 		coodinates = calculator.Calc(option)
 		engine.SetSizeHint(coodinates.ResizeWidth, coodinates.ResizeHeight)
-		logger.WithFields(logrus.Fields{
+		logger.WithContext(ctx).WithFields(logrus.Fields{
 			"width_size_hint":  coodinates.ResizeWidth,
 			"height_size_hint": coodinates.ResizeHeight,
 		}).Debug("size hint")
 	} else {
-		logger.Debug("not set size hint")
+		logger.WithContext(ctx).Debug("not set size hint")
 	}
 
 	err = engine.Open()
 	if err != nil {
-		return &ResizeResult{err: logger.ErrorDebug(err)}
+		return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 	}
 
 	defer engine.Close()
 
+	// sizes and offsets are calculated on the upright image, the same as focal points and the size hint.
+	err = engine.AutoOrient()
+	if err != nil {
+		return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+	}
+
+	if option.NeedsTransform() {
+		err = transform(engine, option)
+		if err != nil {
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+		}
+	}
+
+	// sizes of originals stored before they were of the upright image are of the EXIF orientation.
+	if coodinates != nil && (option.SizeHintWidth > option.SizeHintHeight) != (engine.GetImageWidth() > engine.GetImageHeight()) {
+		coodinates = nil
+	}
+
 	if coodinates == nil {
 		calculator.SetImageSize(engine.GetImageWidth(), engine.GetImageHeight())
 		coodinates = calculator.Calc(option)
 	}
 
+	if option.NeedsSmartCrop && coodinates.CanCrop() {
+		logger.WithContext(ctx).WithFields(logrus.Fields{
+			"crop_width":    coodinates.CropWidth,
+			"crop_height":   coodinates.CropHeight,
+			"width_offset":  coodinates.WidthOffset,
+			"height_offset": coodinates.HeightOffset,
+			"cached":        option.SmartCropFocalPoint != nil,
+		}).Info("smart crop window")
+	}
+
 	if option.NeedsManualCrop {
 		// crop first then resize for manual cropping.
 		err = engine.Crop(coodinates.CropWidth, coodinates.CropHeight, coodinates.WidthOffset, coodinates.HeightOffset)
 		if err != nil {
-			return &ResizeResult{err: logger.ErrorDebug(err)}
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 		}
 
 		err = engine.Resize(coodinates.ResizeWidth, coodinates.ResizeHeight)
 		if err != nil {
-			return &ResizeResult{err: logger.ErrorDebug(err)}
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 		}
 	} else {
 		err = engine.Resize(coodinates.ResizeWidth, coodinates.ResizeHeight)
 		if err != nil {
-			return &ResizeResult{err: logger.ErrorDebug(err)}
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 		}
 
 		if coodinates.CanCrop() {
 			err = engine.Crop(coodinates.CropWidth, coodinates.CropHeight, coodinates.WidthOffset, coodinates.HeightOffset)
 			if err != nil {
-				return &ResizeResult{err: logger.ErrorDebug(err)}
+				return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 			}
 		}
 	}
 
+	if coodinates.CanExtend() {
+		background, err := ParseBackground(option.Background)
+		if err != nil {
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+		}
+		err = engine.Extend(coodinates.ExtendWidth, coodinates.ExtendHeight, coodinates.ExtendX, coodinates.ExtendY, background)
+		if err != nil {
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
+		}
+	}
+
 	if option.HasAlphaChannel() && option.NeedsRemoveAlpha() {
-		logger.Debug("removing alpha channel")
+		logger.WithContext(ctx).Debug("removing alpha channel")
 		err = engine.RemoveAlpha()
 		if err != nil {
-			return &ResizeResult{err: logger.ErrorDebug(err)}
+			return &ResizeResult{err: logger.ErrorDebugContext(ctx, err)}
 		}
 	}
 
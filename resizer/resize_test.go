@@ -0,0 +1,218 @@
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "image/jpeg"
+
+	"github.com/tokubai/kinu/engine"
+)
+
+// golden checksums differ by resize engine, so they are kept per engine and updated by
+// `go test ./resizer -update` with KINU_RESIZE_ENGINE.
+var updateGolden = flag.Bool("update", false, "update golden checksums of resized images")
+
+const GOLDEN_FILE = "testdata/resize_golden.json"
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if len(os.Getenv("KINU_RESIZE_ENGINE")) == 0 {
+		os.Setenv("KINU_RESIZE_ENGINE", "Go")
+	}
+	engine.Initialize()
+
+	code := m.Run()
+
+	engine.Finalize()
+	os.Exit(code)
+}
+
+type resizeGolden struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Checksum string `json:"checksum"`
+}
+
+func gradientPng(t *testing.T, width, height int, alpha bool) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: uint8((x + y) % 256), A: 255}
+			if alpha && x > width/2 {
+				c.A = uint8(y * 255 / height)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pixelChecksum is sha256 of decoded RGBA pixels, so that it does not depend on encoder details.
+func pixelChecksum(t *testing.T, blob []byte) (int, int, string) {
+	src, _, err := image.Decode(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	sum := sha256.Sum256(img.Pix)
+	return img.Bounds().Dx(), img.Bounds().Dy(), hex.EncodeToString(sum[:])
+}
+
+func loadGolden(t *testing.T) map[string]map[string]*resizeGolden {
+	golden := make(map[string]map[string]*resizeGolden)
+	blob, err := ioutil.ReadFile(GOLDEN_FILE)
+	if os.IsNotExist(err) {
+		return golden
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(blob, &golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return golden
+}
+
+func saveGolden(t *testing.T, golden map[string]map[string]*resizeGolden) {
+	blob, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(GOLDEN_FILE), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(GOLDEN_FILE, append(blob, '\n'), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResizeGolden(t *testing.T) {
+	portrait := gradientPng(t, 300, 450, false)
+	landscape := gradientPng(t, 450, 300, false)
+	square := gradientPng(t, 200, 200, false)
+	tiny := gradientPng(t, 3, 2, false)
+	alpha := gradientPng(t, 200, 100, true)
+	thin := gradientPng(t, 1, 281, false)
+
+	cases := []struct {
+		name          string
+		image         []byte
+		geometry      string
+		format        string
+		contentType   string
+		hint          bool
+		width, height int
+	}{
+		{"portrait fixed width", portrait, "w=100", "png", "image/png", false, 100, 150},
+		{"portrait fixed height", portrait, "h=100", "png", "image/png", false, 66, 100},
+		{"portrait fit", portrait, "w=100,h=100", "png", "image/png", false, 66, 100},
+		{"portrait auto crop", portrait, "w=100,h=100,c=true", "png", "image/png", false, 100, 100},
+		{"portrait manual crop", portrait, "w=100,h=50,mc=true,wo=10,ho=20,cw=100,ch=80,aw=150", "png", "image/png", false, 100, 50},
+		{"landscape fit", landscape, "w=100,h=100", "png", "image/png", false, 100, 66},
+		{"landscape auto crop", landscape, "w=280,h=300,c=true", "png", "image/png", false, 280, 300},
+		{"landscape size hint", landscape, "w=150,h=150,c=true", "png", "image/png", true, 150, 150},
+		{"square fit", square, "w=280,h=300", "png", "image/png", false, 280, 280},
+		{"square auto crop", square, "w=50,h=20,c=true", "png", "image/png", false, 50, 20},
+		{"tiny upscale", tiny, "w=30,h=30", "png", "image/png", false, 30, 20},
+		{"tiny auto crop", tiny, "w=10,h=10,c=true", "png", "image/png", false, 10, 10},
+		{"thin fit truncated", thin, "w=50,h=300", "png", "image/png", false, 1, 299},
+		{"alpha to png", alpha, "w=100", "png", "image/png", false, 100, 50},
+		{"portrait contain", portrait, "w=100,h=100,fit=contain", "png", "image/png", false, 100, 100},
+		{"landscape contain with background", landscape, "w=100,h=100,g=north,fit=contain,bg=336699", "png", "image/png", false, 100, 100},
+		{"alpha contain", alpha, "w=100,h=100,fit=contain", "png", "image/png", false, 100, 100},
+		{"portrait fill", portrait, "w=100,h=100,fit=fill", "png", "image/png", false, 100, 100},
+		{"tiny inside", tiny, "w=30,h=30,fit=inside", "png", "image/png", false, 3, 2},
+		{"portrait outside", portrait, "w=100,h=100,fit=outside", "png", "image/png", false, 100, 150},
+		{"portrait rotate", portrait, "w=100,r=90", "png", "image/png", false, 100, 66},
+		{"landscape rotate auto crop with size hint", landscape, "w=100,h=150,c=true,r=270", "png", "image/png", true, 100, 150},
+		{"portrait flip", portrait, "h=100,flip=h", "png", "image/png", false, 66, 100},
+		{"landscape rotate and flip", landscape, "w=100,r=180,flip=v", "png", "image/png", false, 100, 66},
+		{"alpha to jpeg", alpha, "w=100", "jpg", "image/png", false, 100, 50},
+	}
+
+	golden := loadGolden(t)
+	engineType := os.Getenv("KINU_RESIZE_ENGINE")
+	if golden[engineType] == nil {
+		golden[engineType] = make(map[string]*resizeGolden)
+	}
+
+	for _, c := range cases {
+		geometry, err := ParseGeometry(c.geometry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		option := geometry.ToResizeOption()
+		option.Format = c.format
+		option.SourceContentType = c.contentType
+		if c.hint {
+			config, _, err := image.DecodeConfig(bytes.NewReader(c.image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			option.SizeHintWidth, option.SizeHintHeight = config.Width, config.Height
+		}
+
+		result := Resize(context.Background(), c.image, option)
+		if result.err != nil {
+			t.Errorf("%s: %s", c.name, result.err)
+			continue
+		}
+
+		width, height, checksum := pixelChecksum(t, result.image)
+		if width != c.width || height != c.height {
+			t.Errorf("%s: size is %dx%d, want %dx%d", c.name, width, height, c.width, c.height)
+		}
+
+		// jpeg checksums depend on the encoder, only png outputs are compared.
+		if c.format != "png" {
+			continue
+		}
+
+		if *updateGolden {
+			golden[engineType][c.name] = &resizeGolden{Width: width, Height: height, Checksum: checksum}
+			continue
+		}
+
+		want, ok := golden[engineType][c.name]
+		if !ok {
+			t.Logf("%s: no golden checksum for %s engine, run with -update", c.name, engineType)
+			continue
+		}
+		if want.Width != width || want.Height != height || want.Checksum != checksum {
+			t.Errorf("%s: got %dx%d %s, want %dx%d %s", c.name, width, height, checksum, want.Width, want.Height, want.Checksum)
+		}
+	}
+
+	if *updateGolden {
+		saveGolden(t, golden)
+	}
+}
+
+func TestCheckEngine(t *testing.T) {
+	err := CheckEngine()
+	if err != nil {
+		t.Errorf("engine %s: %s", engine.SelectedEngineType(), err)
+	}
+}
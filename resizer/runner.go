@@ -1,19 +1,24 @@
 package resizer
 
 import (
+	"context"
 	"errors"
 	"os"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/metrics"
 )
 
 type ResizeRequest struct {
+	ctx           context.Context
 	image         []byte
 	option        *ResizeOption
 	resultPayload chan *ResizeResult
+	queuedAt      time.Time
 }
 
 type ResizeResult struct {
@@ -32,22 +37,44 @@ var (
 	requestPayload chan *ResizeRequest
 )
 
-func Run(image []byte, option *ResizeOption) (resizedImage []byte, err error) {
+// Run resizes the image, it returns the error of the context when the context is done before the resize,
+// or while waiting for a worker. a resize already started by a worker is not interrupted.
+func Run(ctx context.Context, image []byte, option *ResizeOption) (resizedImage []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if !IsWorkerMode {
-		result := Resize(image, option)
+		result := measuredResize(ctx, image, option)
 		return result.image, result.err
 	}
 
 	if CanResizeRequest() {
-		request := &ResizeRequest{image: image, option: option, resultPayload: make(chan *ResizeResult, 1)}
-		requestPayload <- request
-		result := <-request.resultPayload
-		return result.image, result.err
+		request := &ResizeRequest{ctx: ctx, image: image, option: option, resultPayload: make(chan *ResizeResult, 1), queuedAt: time.Now()}
+		select {
+		case requestPayload <- request:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		select {
+		case result := <-request.resultPayload:
+			return result.image, result.err
+		case <-ctx.Done():
+			// the worker skips the request, or the result is dropped.
+			return nil, ctx.Err()
+		}
 	} else {
+		metrics.ResizeRejections.Inc()
 		return nil, ErrTooManyRunningResizeWorker
 	}
 }
 
+func measuredResize(ctx context.Context, image []byte, option *ResizeOption) *ResizeResult {
+	defer metrics.ObserveSince(metrics.ResizeSeconds, time.Now())
+	return Resize(ctx, image, option)
+}
+
 func RequestPayloadLen() int {
 	return len(requestPayload)
 }
@@ -91,6 +118,11 @@ func init() {
 
 	requestPayload = make(chan *ResizeRequest, ResizeWorkerWaitBufferNum)
 
+	metrics.Register(metrics.NewGaugeFunc(
+		"kinu_resize_queue_depth",
+		"Number of resize requests waiting for a worker.",
+		func() float64 { return float64(RequestPayloadLen()) }))
+
 	runWorker()
 }
 
@@ -110,11 +142,19 @@ func worker(id int, requests <-chan *ResizeRequest) {
 	}).Debug("launch resize worker")
 
 	for r := range requests {
-		logger.WithFields(logrus.Fields{
+		logger.WithContext(r.ctx).WithFields(logrus.Fields{
 			"worker_id": id,
 		}).Debug("processing resize from worker")
 
-		r.resultPayload <- Resize(r.image, r.option)
+		metrics.ObserveSince(metrics.ResizeQueueWaitSeconds, r.queuedAt)
+		if err := r.ctx.Err(); err != nil {
+			logger.WithContext(r.ctx).WithFields(logrus.Fields{
+				"worker_id": id,
+			}).Debug("skip canceled resize request")
+			r.resultPayload <- &ResizeResult{err: err}
+			continue
+		}
+		r.resultPayload <- measuredResize(r.ctx, r.image, r.option)
 	}
 }
 
@@ -130,6 +170,23 @@ type ResizeOption struct {
 	AssumptionWidth  int
 	Quality          int
 
+	Gravity    string
+	FocalPoint *FocalPoint
+
+	// Fit is the fit mode of fixed width and height, Background is rrggbb to pad with fit=contain.
+	Fit        string
+	Background string
+
+	// Rotate and Flip are applied after the EXIF orientation, the rotation persisted for the image is added to Rotate.
+	Rotate int
+	Flip   string
+
+	// NeedsSmartCrop takes the focal point of auto crop from SmartCropFocalPoint when it is cached,
+	// otherwise from the analysis of the image, which is passed to OnSmartCrop.
+	NeedsSmartCrop      bool
+	SmartCropFocalPoint *FocalPoint
+	OnSmartCrop         func(focalPoint *FocalPoint)
+
 	SizeHintWidth  int
 	SizeHintHeight int
 
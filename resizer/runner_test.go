@@ -0,0 +1,46 @@
+package resizer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Run(ctx, healthCheckImage, &ResizeOption{Width: 2, Height: 2})
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestRunCanceledInQueue(t *testing.T) {
+	defer func(mode bool, buffer int, payload chan *ResizeRequest) {
+		IsWorkerMode, ResizeWorkerWaitBufferNum, requestPayload = mode, buffer, payload
+	}(IsWorkerMode, ResizeWorkerWaitBufferNum, requestPayload)
+
+	// no worker takes the request from the queue.
+	IsWorkerMode, ResizeWorkerWaitBufferNum = true, 1
+	requestPayload = make(chan *ResizeRequest, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := Run(ctx, healthCheckImage, &ResizeOption{Width: 2, Height: 2})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+
+	// the worker skips the request canceled while waiting.
+	request := <-requestPayload
+	requests := make(chan *ResizeRequest, 1)
+	requests <- request
+	close(requests)
+	worker(1, requests)
+
+	result := <-request.resultPayload
+	if result.err != context.DeadlineExceeded || result.image != nil {
+		t.Errorf("got %v, want context.DeadlineExceeded without resize", result.err)
+	}
+}
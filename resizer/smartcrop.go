@@ -0,0 +1,266 @@
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/engine"
+	"github.com/tokubai/kinu/logger"
+)
+
+// Smart crop picks the auto crop window by a saliency heuristic like smartcrop.js,
+// edge density, skin tone and saturation of a downscaled copy are scored in cells,
+// and the window with the most salient cells near its center is chosen.
+const (
+	SMART_CROP_ANALYSIS_SIZE = 256
+	SMART_CROP_CELL_SIZE     = 4
+
+	smartCropDetailWeight     = 0.2
+	smartCropSkinWeight       = 1.8
+	smartCropSaturationWeight = 0.1
+
+	smartCropSkinThreshold       = 0.8
+	smartCropSkinBrightnessMin   = 0.2
+	smartCropSkinBrightnessMax   = 1.0
+	smartCropSaturationThreshold = 0.4
+	smartCropSaturationBrightMin = 0.05
+	smartCropSaturationBrightMax = 0.9
+
+	smartCropOutsideImportance = -0.5
+	smartCropEdgeRadius        = 0.4
+	smartCropEdgeWeight        = -20.0
+	smartCropRuleOfThirdsBoost = 1.2
+)
+
+var (
+	// skin tone as a normalized rgb vector.
+	smartCropSkinColor = normalizeColor(0.78, 0.57, 0.44)
+)
+
+// saliencyMap is the sum of scores of pixels in each cell.
+type saliencyMap struct {
+	width, height int
+	cells         []float64
+}
+
+func normalizeColor(r, g, b float64) [3]float64 {
+	mag := math.Sqrt(r*r + g*g + b*b)
+	if mag == 0 {
+		return [3]float64{}
+	}
+	return [3]float64{r / mag, g / mag, b / mag}
+}
+
+func analyzeSaliency(img image.Image) *saliencyMap {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	pixels := make([][3]float64, width*height)
+	lightness := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixel := [3]float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff}
+			pixels[y*width+x] = pixel
+			lightness[y*width+x] = 0.2126*pixel[0] + 0.7152*pixel[1] + 0.0722*pixel[2]
+		}
+	}
+
+	m := &saliencyMap{
+		width:  (width + SMART_CROP_CELL_SIZE - 1) / SMART_CROP_CELL_SIZE,
+		height: (height + SMART_CROP_CELL_SIZE - 1) / SMART_CROP_CELL_SIZE,
+	}
+	m.cells = make([]float64, m.width*m.height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			score := detailScore(lightness, width, height, x, y)*smartCropDetailWeight +
+				skinScore(pixels[i], lightness[i])*smartCropSkinWeight +
+				saturationScore(pixels[i], lightness[i])*smartCropSaturationWeight
+			m.cells[(y/SMART_CROP_CELL_SIZE)*m.width+x/SMART_CROP_CELL_SIZE] += score
+		}
+	}
+
+	return m
+}
+
+// detailScore is the absolute laplacian of the lightness, neighbors out of the image are ignored.
+func detailScore(lightness []float64, width, height, x, y int) float64 {
+	center := lightness[y*width+x]
+	var sum float64
+	for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || ny < 0 || nx >= width || ny >= height {
+			continue
+		}
+		sum += center - lightness[ny*width+nx]
+	}
+	return math.Abs(sum)
+}
+
+func skinScore(pixel [3]float64, lightness float64) float64 {
+	if lightness < smartCropSkinBrightnessMin || lightness > smartCropSkinBrightnessMax {
+		return 0
+	}
+	color := normalizeColor(pixel[0], pixel[1], pixel[2])
+	var distance float64
+	for i := range color {
+		distance += (color[i] - smartCropSkinColor[i]) * (color[i] - smartCropSkinColor[i])
+	}
+	skin := 1 - math.Sqrt(distance)
+	if skin < smartCropSkinThreshold {
+		return 0
+	}
+	return (skin - smartCropSkinThreshold) / (1 - smartCropSkinThreshold)
+}
+
+func saturationScore(pixel [3]float64, lightness float64) float64 {
+	if lightness < smartCropSaturationBrightMin || lightness > smartCropSaturationBrightMax {
+		return 0
+	}
+	max := math.Max(pixel[0], math.Max(pixel[1], pixel[2]))
+	min := math.Min(pixel[0], math.Min(pixel[1], pixel[2]))
+	if max == min {
+		return 0
+	}
+	l := (max + min) / 2
+	var saturation float64
+	if l > 0.5 {
+		saturation = (max - min) / (2 - max - min)
+	} else {
+		saturation = (max - min) / (max + min)
+	}
+	if saturation < smartCropSaturationThreshold {
+		return 0
+	}
+	return (saturation - smartCropSaturationThreshold) / (1 - smartCropSaturationThreshold)
+}
+
+func thirds(x float64) float64 {
+	x = (math.Mod(x-1.0/3+1.0, 2.0)*0.5 - 0.5) * 16
+	return math.Max(1.0-x*x, 0)
+}
+
+// importance weights a cell by its position in the window, cells out of the window are penalized,
+// and cells near the center or on the rule of thirds lines are preferred over the edges.
+func importance(x, y, windowX, windowY, windowWidth, windowHeight float64) float64 {
+	if x < windowX || x >= windowX+windowWidth || y < windowY || y >= windowY+windowHeight {
+		return smartCropOutsideImportance
+	}
+	px := math.Abs(0.5-(x-windowX)/windowWidth) * 2
+	py := math.Abs(0.5-(y-windowY)/windowHeight) * 2
+	dx := math.Max(px-1.0+smartCropEdgeRadius, 0)
+	dy := math.Max(py-1.0+smartCropEdgeRadius, 0)
+	d := (dx*dx + dy*dy) * smartCropEdgeWeight
+	s := 1.41 - math.Sqrt(px*px+py*py)
+	s += math.Max(0, s+d+0.5) * smartCropRuleOfThirdsBoost * (thirds(px) + thirds(py))
+	return s + d
+}
+
+// focalPoint returns the center of the most salient window of the aspect ratio of width and height,
+// the window is as large as possible, so it slides along one axis only.
+func (m *saliencyMap) focalPoint(width int, height int) *FocalPoint {
+	windowWidth, windowHeight := m.width, m.height
+	if m.width*height > width*m.height {
+		windowWidth = int(math.Round(float64(m.height*width) / float64(height)))
+	} else {
+		windowHeight = int(math.Round(float64(m.width*height) / float64(width)))
+	}
+	if windowWidth < 1 {
+		windowWidth = 1
+	}
+	if windowHeight < 1 {
+		windowHeight = 1
+	}
+
+	bestX, bestY, bestScore := 0, 0, math.Inf(-1)
+	for windowY := 0; windowY+windowHeight <= m.height; windowY++ {
+		for windowX := 0; windowX+windowWidth <= m.width; windowX++ {
+			var score float64
+			for y := 0; y < m.height; y++ {
+				for x := 0; x < m.width; x++ {
+					// importance is taken at the center of the cell.
+					score += m.cells[y*m.width+x] * importance(float64(x)+0.5, float64(y)+0.5, float64(windowX), float64(windowY), float64(windowWidth), float64(windowHeight))
+				}
+			}
+			// the first window wins ties, so that the result is deterministic.
+			if score > bestScore {
+				bestX, bestY, bestScore = windowX, windowY, score
+			}
+		}
+	}
+
+	return &FocalPoint{
+		X: (float64(bestX) + float64(windowWidth)/2) / float64(m.width),
+		Y: (float64(bestY) + float64(windowHeight)/2) / float64(m.height),
+	}
+}
+
+// smartCropFocalPoint analyzes a copy of the image downscaled by the engine to SMART_CROP_ANALYSIS_SIZE.
+func smartCropFocalPoint(ctx context.Context, imageBlob []byte, option *ResizeOption) (*FocalPoint, error) {
+	e, err := engine.New(imageBlob)
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	analysisSize := &CoodinatesCalculator{Width: SMART_CROP_ANALYSIS_SIZE, Height: SMART_CROP_ANALYSIS_SIZE}
+	if option.HasSizeHint() && !option.NeedsTransform() {
+		analysisSize.SetImageSize(option.SizeHintWidth, option.SizeHintHeight)
+		hint := analysisSize.Resize()
+		e.SetSizeHint(hint.ResizeWidth, hint.ResizeHeight)
+	}
+
+	err = e.Open()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+	defer e.Close()
+
+	err = e.AutoOrient()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	if option.NeedsTransform() {
+		err = transform(e, option)
+		if err != nil {
+			return nil, logger.ErrorDebugContext(ctx, err)
+		}
+	}
+
+	analysisSize.SetImageSize(e.GetImageWidth(), e.GetImageHeight())
+	coodinates := analysisSize.Resize()
+	if e.GetImageWidth() > coodinates.ResizeWidth {
+		err = e.Resize(coodinates.ResizeWidth, coodinates.ResizeHeight)
+		if err != nil {
+			return nil, logger.ErrorDebugContext(ctx, err)
+		}
+	}
+
+	e.SetFormat("png")
+	blob, err := e.Generate()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(blob))
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	focalPoint := analyzeSaliency(img).focalPoint(option.Width, option.Height)
+
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"analysis_width":  img.Bounds().Dx(),
+		"analysis_height": img.Bounds().Dy(),
+		"focal_x":         focalPoint.X,
+		"focal_y":         focalPoint.Y,
+	}).Debug("smart crop analysis")
+
+	return focalPoint, nil
+}
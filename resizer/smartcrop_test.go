@@ -0,0 +1,89 @@
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+// subjectImage is a flat gray image with a saturated square centered at (cx, cy).
+func subjectImage(width, height, cx, cy, size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.NRGBA{R: 128, G: 128, B: 128, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(cx-size/2, cy-size/2, cx+size/2, cy+size/2), &image.Uniform{color.NRGBA{R: 230, G: 30, B: 30, A: 255}}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestSmartCropFocalPoint(t *testing.T) {
+	cases := []struct {
+		name          string
+		img           *image.NRGBA
+		width, height int
+		check         func(focalPoint *FocalPoint) bool
+	}{
+		{"subject on the left", subjectImage(256, 128, 40, 64, 32), 100, 100, func(f *FocalPoint) bool { return f.X < 0.4 }},
+		{"subject on the right", subjectImage(256, 128, 216, 64, 32), 100, 100, func(f *FocalPoint) bool { return f.X > 0.6 }},
+		{"subject on the top", subjectImage(128, 256, 64, 40, 32), 100, 100, func(f *FocalPoint) bool { return f.Y < 0.4 }},
+		{"subject on the bottom", subjectImage(128, 256, 64, 216, 32), 200, 100, func(f *FocalPoint) bool { return f.Y > 0.6 }},
+	}
+
+	for _, c := range cases {
+		got := analyzeSaliency(c.img).focalPoint(c.width, c.height)
+		if !c.check(got) {
+			t.Errorf("%s: got %+v", c.name, got)
+		}
+		if again := analyzeSaliency(c.img).focalPoint(c.width, c.height); *again != *got {
+			t.Errorf("%s: not deterministic, got %+v and %+v", c.name, got, again)
+		}
+	}
+}
+
+func TestResizeSmartCrop(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, subjectImage(600, 300, 80, 150, 60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var analyzed *FocalPoint
+	option := &ResizeOption{Width: 100, Height: 100, NeedsAutoCrop: true, NeedsSmartCrop: true, Format: "png",
+		OnSmartCrop: func(focalPoint *FocalPoint) { analyzed = focalPoint }}
+	result := Resize(context.Background(), buf.Bytes(), option)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if analyzed == nil {
+		t.Fatal("OnSmartCrop is not called")
+	}
+
+	img, err := png.Decode(bytes.NewReader(result.image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 100 {
+		t.Fatalf("got %v", img.Bounds())
+	}
+	// the subject at x=80 of 600 is at x=26 of the resized 200x100, out of the centered crop.
+	if r, _, _, _ := img.At(26, 50).RGBA(); r>>8 < 200 {
+		t.Errorf("subject is cropped out, got %v at (26, 50)", img.At(26, 50))
+	}
+
+	// the cached focal point is used without the analysis.
+	analyzed = nil
+	option.SmartCropFocalPoint = &FocalPoint{X: 1, Y: 0.5}
+	result = Resize(context.Background(), buf.Bytes(), option)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if analyzed != nil {
+		t.Error("OnSmartCrop is called with the cached focal point")
+	}
+	img, _ = png.Decode(bytes.NewReader(result.image))
+	if r, _, _, _ := img.At(26, 50).RGBA(); r>>8 > 200 {
+		t.Errorf("cached focal point is not used, got %v at (26, 50)", img.At(26, 50))
+	}
+}
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -42,15 +43,15 @@ func (r *BackwardCompatibleResource) FilePath(size string) string {
 	}
 }
 
-func (r *BackwardCompatibleResource) RecentOriginalFileKey() (string, error) {
+func (r *BackwardCompatibleResource) RecentOriginalFileKey(ctx context.Context) (string, error) {
 	s, err := storage.Open()
 	if err != nil {
-		return "", logger.ErrorDebug(err)
+		return "", logger.ErrorDebugContext(ctx, err)
 	}
 
-	items, err := s.List(fmt.Sprintf("%s/%s/%s.original", r.Category, r.Id, r.Id))
+	items, err := s.List(ctx, fmt.Sprintf("%s/%s/%s.original", r.Category, r.Id, r.Id))
 	if err != nil {
-		return "", logger.ErrorDebug(err)
+		return "", logger.ErrorDebugContext(ctx, err)
 	}
 
 	if len(items) == 0 {
@@ -65,7 +66,7 @@ func (r *BackwardCompatibleResource) RecentOriginalFileKey() (string, error) {
 		if timestamp >= recentTimestamp {
 			recentItem = i
 			recentTimestamp = recentTimestamp
-			logger.WithFields(logrus.Fields{"key": i.Key(), "timestamp": timestamp}).Debug("update recent original image")
+			logger.WithContext(ctx).WithFields(logrus.Fields{"key": i.Key(), "timestamp": timestamp}).Debug("update recent original image")
 		}
 	}
 
@@ -76,17 +77,17 @@ func (r *BackwardCompatibleResource) BasePath() string {
 	return fmt.Sprintf("%s/%s", r.Category, r.Id)
 }
 
-func (r *BackwardCompatibleResource) Fetch(geo *resizer.Geometry) (*Image, error) {
+func (r *BackwardCompatibleResource) Fetch(ctx context.Context, geo *resizer.Geometry) (*Image, error) {
 	var middleImageSize string
 	if geo.NeedsOriginalImage {
 		middleImageSize = "original"
 	} else if len(geo.MiddleImageSize) != 0 {
 		middleImageSize = geo.MiddleImageSize
-	} else if geo.Height <= 1000 && geo.Width <= 1000 {
+	} else if width, height := geo.ScaledSize(); height <= 1000 && width <= 1000 {
 		middleImageSize = "1000"
-	} else if geo.Height <= 2000 && geo.Width <= 2000 {
+	} else if height <= 2000 && width <= 2000 {
 		middleImageSize = "2000"
-	} else if geo.Height <= 3000 && geo.Width <= 3000 {
+	} else if height <= 3000 && width <= 3000 {
 		middleImageSize = "3000"
 	} else {
 		middleImageSize = "original"
@@ -96,55 +97,59 @@ func (r *BackwardCompatibleResource) Fetch(geo *resizer.Geometry) (*Image, error
 
 	st, err := storage.Open()
 	if err != nil {
-		return image, logger.ErrorDebug(err)
+		return image, logger.ErrorDebugContext(ctx, err)
 	}
 
 	var path string
 	if middleImageSize == "1000" {
 		path = r.FilePath(middleImageSize)
 	} else {
-		path, err = r.RecentOriginalFileKey()
+		path, err = r.RecentOriginalFileKey(ctx)
 		if err != nil {
 			// There are cases where there is no original image and only an intermediate image exists.
 			path = r.FilePath("1000")
 		}
 	}
 
-	obj, err := st.Fetch(path)
+	obj, err := fetchObject(ctx, st, path)
 	if err != nil {
-		return image, logger.ErrorDebug(err)
+		return image, logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.Body = obj.Body
+	image.Version = obj.Version
+	image.LastModified = obj.LastModified
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"metadata": obj.Metadata,
 	}).Debug("metadata")
 
 	image.Height, err = strconv.Atoi(obj.Metadata["Height"])
 	if err != nil {
-		logger.ErrorDebug(err)
+		logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.Width, err = strconv.Atoi(obj.Metadata["Width"])
 	if err != nil {
-		logger.ErrorDebug(err)
+		logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.ContentType = obj.Metadata["Content-Type"]
+	image.FocalPoint = focalPointOf(obj.Metadata)
+	setOriginalSize(image, obj.Metadata)
 
 	return image, nil
 }
 
-func (r *BackwardCompatibleResource) MoveTo(category, id string) error {
+func (r *BackwardCompatibleResource) MoveTo(ctx context.Context, category, id string) error {
 	st, err := storage.Open()
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
-	items, err := st.List(r.BasePath())
+	items, err := st.List(ctx, r.BasePath())
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	moveToResource := New(category, id)
@@ -157,18 +162,18 @@ func (r *BackwardCompatibleResource) MoveTo(category, id string) error {
 			defer wg.Done()
 			st, err := storage.Open()
 			if err != nil {
-				errs <- logger.ErrorDebug(err)
+				errs <- logger.ErrorDebugContext(ctx, err)
 				return
 			}
 
 			if strings.Contains(item.Key(), "filetype") {
-				err = st.Move(item.Key(), moveToResource.BasePath()+"/"+item.Filename())
+				err = st.Move(ctx, item.Key(), moveToResource.BasePath()+"/"+item.Filename())
 			} else {
-				err = st.Move(item.Key(), moveToResource.FilePath(item.ImageSize()))
+				err = st.Move(ctx, item.Key(), moveToResource.FilePath(item.ImageSize()))
 			}
 
 			if err != nil {
-				errs <- logger.ErrorDebug(err)
+				errs <- logger.ErrorDebugContext(ctx, err)
 				return
 			}
 
@@ -193,7 +198,7 @@ func (r *BackwardCompatibleResource) MoveTo(category, id string) error {
 	return nil
 }
 
-func (r *BackwardCompatibleResource) Store(file io.ReadSeeker) error {
+func (r *BackwardCompatibleResource) Store(ctx context.Context, file io.ReadSeeker, focalPoint *resizer.FocalPoint) error {
 	imageData, err := ioutil.ReadAll(file)
 	if err != nil {
 		return &ErrStore{Message: "invalid file"}
@@ -218,6 +223,7 @@ func (r *BackwardCompatibleResource) Store(file io.ReadSeeker) error {
 		return &ErrStore{Message: "unsupported filetype, supported jpg or png or gif or pdf"}
 	}
 
+	metadata := imageMetadata(imageData, focalPoint)
 	uploaders := make([]uploader.Uploader, 0)
 	for _, size := range []string{"original", "1000"} {
 		uploaders = append(uploaders, &uploader.ImageUploader{
@@ -226,6 +232,7 @@ func (r *BackwardCompatibleResource) Store(file io.ReadSeeker) error {
 			UploadSize:  size,
 			ContentType: contentType,
 			Ext:         ext,
+			Metadata:    metadata,
 		})
 	}
 
@@ -235,5 +242,38 @@ func (r *BackwardCompatibleResource) Store(file io.ReadSeeker) error {
 		},
 	)
 
-	return uploader.Upload(uploaders)
+	return uploader.Upload(ctx, uploaders)
+}
+
+func (r *BackwardCompatibleResource) Delete(ctx context.Context) error {
+	return deleteAll(ctx, r.BasePath())
+}
+
+func (r *BackwardCompatibleResource) Info(ctx context.Context) (*ImageInfo, error) {
+	return buildImageInfo(ctx, r.Category, r.Id, r.BasePath(), func(item storage.StorageItem) bool {
+		return !strings.Contains(item.Key(), "filetype")
+	})
+}
+
+// derived image cache is not supported in backward compatible mode.
+func (r *BackwardCompatibleResource) FetchDerived(ctx context.Context, geometry string, ext string, source *Image) (*Image, error) {
+	return nil, storage.ErrImageNotFound
+}
+
+func (r *BackwardCompatibleResource) StoreDerived(ctx context.Context, geometry string, ext string, resized []byte, contentType string, source *Image) error {
+	return nil
+}
+
+// smart crop cache is not supported in backward compatible mode.
+func (r *BackwardCompatibleResource) FetchSmartCrop(ctx context.Context, width int, height int, source *Image) (*resizer.FocalPoint, error) {
+	return nil, storage.ErrImageNotFound
+}
+
+func (r *BackwardCompatibleResource) StoreSmartCrop(ctx context.Context, width int, height int, focalPoint *resizer.FocalPoint, source *Image) error {
+	return nil
+}
+
+// rotation is not supported in backward compatible mode.
+func (r *BackwardCompatibleResource) Rotate(ctx context.Context, degrees int) error {
+	return ErrRotationNotSupported
 }
@@ -0,0 +1,214 @@
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+// Derived images are resized images persisted back to the storage, next to the middle images as
+// :image_type/:id/derived.:hash.:format, so that they are listed, moved and deleted with the image.
+// the hash includes the version and the rotation of the source middle image, so that images resized from the previous
+// upload or rotation are never served even when they are stored after the upload deleted derived images.
+const DERIVED_FILENAME_PREFIX = "derived."
+
+// Bytes of derived images per image are listed from the storage once in DERIVED_USAGE_TTL and added up by stores
+// of this process, so that the storage is not listed on every store. stores of other processes are seen after the ttl,
+// until then the budget is exceeded by them. usages are dropped all at once when they are of DERIVED_USAGE_MAX_IMAGES.
+const (
+	DERIVED_USAGE_TTL        = time.Minute
+	DERIVED_USAGE_MAX_IMAGES = 10000
+)
+
+type derivedUsage struct {
+	bytes    int64
+	listedAt time.Time
+}
+
+var (
+	derivedCacheCategories = make(map[string]bool)
+
+	derivedUsagesMu sync.Mutex
+	derivedUsages   = make(map[string]*derivedUsage)
+
+	// DerivedCacheMaxBytes is the budget of derived images per image, 0 means unlimited.
+	DerivedCacheMaxBytes int64
+)
+
+func init() {
+	categories := os.Getenv("KINU_DERIVED_CACHE_CATEGORIES")
+	if len(categories) == 0 {
+		return
+	}
+
+	if config.BackwardCompatibleMode {
+		logger.Warn("derived image cache is not supported in backward compatible mode.")
+		return
+	}
+
+	for _, category := range strings.Split(categories, ",") {
+		if len(category) != 0 {
+			derivedCacheCategories[category] = true
+		}
+	}
+
+	maxBytes := os.Getenv("KINU_DERIVED_CACHE_MAX_BYTES")
+	if len(maxBytes) != 0 {
+		num, err := strconv.ParseInt(maxBytes, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		DerivedCacheMaxBytes = num
+	}
+
+	logger.WithFields(logrus.Fields{
+		"categories": categories,
+		"max_bytes":  DerivedCacheMaxBytes,
+	}).Info("enable derived image cache")
+}
+
+func IsDerivedCacheEnabled(category string) bool {
+	return derivedCacheCategories[category]
+}
+
+func isDerivedItem(item storage.StorageItem) bool {
+	return strings.HasPrefix(item.Filename(), DERIVED_FILENAME_PREFIX)
+}
+
+func (r *KinuResource) DerivedFilePath(geometry string, ext string, source *Image) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{geometry, ext, resizer.EngineType()}, sourceFields(source)...), "\n")))
+	return r.BasePath() + "/" + DERIVED_FILENAME_PREFIX + hex.EncodeToString(sum[:16]) + "." + ext
+}
+
+// FetchDerived returns the derived image of the canonical geometry resized from the source image,
+// Version and LastModified are of the source image.
+func (r *KinuResource) FetchDerived(ctx context.Context, geometry string, ext string, source *Image) (*Image, error) {
+	st, err := storage.Open()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	obj, err := fetchObject(ctx, st, r.DerivedFilePath(geometry, ext, source))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Body:         obj.Body,
+		ContentType:  obj.Metadata["Content-Type"],
+		Version:      source.Version,
+		LastModified: source.LastModified,
+	}, nil
+}
+
+// StoreDerived persists the resized image of the source, it is skipped when the image exceeds the budget.
+func (r *KinuResource) StoreDerived(ctx context.Context, geometry string, ext string, resized []byte, contentType string, source *Image) error {
+	st, err := storage.Open()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	if DerivedCacheMaxBytes != 0 {
+		reserved, err := reserveDerivedBytes(ctx, st, r.BasePath(), int64(len(resized)))
+		if err != nil {
+			return logger.ErrorDebugContext(ctx, err)
+		}
+		if !reserved {
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				"base_path": r.BasePath(),
+				"bytes":     len(resized),
+			}).Debug("derived image cache budget is exceeded")
+			return nil
+		}
+	}
+
+	metadata := map[string]string{
+		"Source-Version": source.Version,
+	}
+
+	return st.PutFromBlob(ctx, r.DerivedFilePath(geometry, ext, source), resized, contentType, metadata)
+}
+
+// reserveDerivedBytes adds the bytes to the usage of the image, false when they exceed the budget.
+// bytes of failed stores remain reserved until the usage is listed again.
+func reserveDerivedBytes(ctx context.Context, st storage.Storage, basePath string, bytes int64) (bool, error) {
+	derivedUsagesMu.Lock()
+	usage, ok := derivedUsages[basePath]
+	derivedUsagesMu.Unlock()
+
+	if !ok || time.Since(usage.listedAt) > DERIVED_USAGE_TTL {
+		items, err := st.List(ctx, basePath+"/")
+		if err != nil {
+			return false, err
+		}
+
+		usage = &derivedUsage{listedAt: time.Now()}
+		for _, item := range items {
+			if isDerivedItem(item) {
+				usage.bytes += item.Size()
+			}
+		}
+
+		derivedUsagesMu.Lock()
+		if len(derivedUsages) >= DERIVED_USAGE_MAX_IMAGES {
+			derivedUsages = make(map[string]*derivedUsage)
+		}
+		derivedUsages[basePath] = usage
+		derivedUsagesMu.Unlock()
+	}
+
+	derivedUsagesMu.Lock()
+	defer derivedUsagesMu.Unlock()
+	if usage.bytes+bytes > DerivedCacheMaxBytes {
+		return false, nil
+	}
+	usage.bytes += bytes
+	return true, nil
+}
+
+// forgetDerivedUsage drops the usage of the image, so that it is listed again by the next store.
+func forgetDerivedUsage(basePath string) {
+	derivedUsagesMu.Lock()
+	defer derivedUsagesMu.Unlock()
+	delete(derivedUsages, basePath)
+}
+
+// deleteDerived removes derived images and smart crop windows under the base path, they are stale after the image is replaced.
+func deleteDerived(ctx context.Context, basePath string) error {
+	defer forgetDerivedUsage(basePath)
+
+	st, err := storage.Open()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	items, err := st.List(ctx, basePath+"/")
+	if err == storage.ErrImageNotFound {
+		return nil
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	for _, item := range items {
+		if !isDerivedItem(item) && !isSmartCropItem(item) || strings.HasSuffix(item.Filename(), ".metadata") {
+			continue
+		}
+		err = st.Delete(ctx, item.Key())
+		if err != nil && err != storage.ErrImageNotFound {
+			return logger.ErrorDebugContext(ctx, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "kinu-resource")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("KINU_STORAGE_TYPE", "File")
+	os.Setenv("KINU_FILE_DIRECTORY", dir)
+	storage.Initialize()
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// putMiddleImage stores the 1000 middle image of the resource and returns it fetched as the source of derived images.
+func putMiddleImage(t *testing.T, r *KinuResource, body string) *Image {
+	ctx := context.Background()
+	st, err := storage.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.PutFromBlob(ctx, r.FilePath("1000"), []byte(body), "image/jpeg", map[string]string{"Width": "1000", "Height": "800"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := r.Fetch(ctx, &resizer.Geometry{Width: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+func TestDerivedStoreAndFetch(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "derived", Id: "store"}
+	source := putMiddleImage(t, r, "middle")
+
+	_, err := r.FetchDerived(ctx, "w=100", "jpg", source)
+	if err != storage.ErrImageNotFound {
+		t.Fatalf("got %v before stored", err)
+	}
+
+	err = r.StoreDerived(ctx, "w=100", "jpg", []byte("resized"), "image/jpeg", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	derived, err := r.FetchDerived(ctx, "w=100", "jpg", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(derived.Body) != "resized" || derived.ContentType != "image/jpeg" {
+		t.Errorf("got %q of %s", derived.Body, derived.ContentType)
+	}
+	if derived.Version != source.Version || !derived.LastModified.Equal(source.LastModified) {
+		t.Errorf("got version %s at %s, want %s at %s", derived.Version, derived.LastModified, source.Version, source.LastModified)
+	}
+
+	_, err = r.FetchDerived(ctx, "w=200", "jpg", source)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v for another geometry", err)
+	}
+}
+
+func TestDerivedOfReplacedSource(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "derived", Id: "replaced"}
+	oldSource := putMiddleImage(t, r, "old middle")
+
+	err := r.StoreDerived(ctx, "w=100", "jpg", []byte("old resized"), "image/jpeg", oldSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSource := putMiddleImage(t, r, "new middle image")
+	if newSource.Version == oldSource.Version {
+		t.Fatalf("version %s is not changed", newSource.Version)
+	}
+
+	// stored by a resize of the old source in flight after the new source is uploaded.
+	err = r.StoreDerived(ctx, "w=100", "jpg", []byte("old resized"), "image/jpeg", oldSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.FetchDerived(ctx, "w=100", "jpg", newSource)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v, derived image of the old source is served", err)
+	}
+}
+
+func TestDerivedBudget(t *testing.T) {
+	defer func(maxBytes int64) { DerivedCacheMaxBytes = maxBytes }(DerivedCacheMaxBytes)
+	DerivedCacheMaxBytes = 12
+
+	ctx := context.Background()
+	r := &KinuResource{Category: "derived", Id: "budget"}
+	source := putMiddleImage(t, r, "middle")
+
+	for _, geometry := range []string{"w=100", "w=200"} {
+		err := r.StoreDerived(ctx, geometry, "jpg", []byte("resized"), "image/jpeg", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := r.FetchDerived(ctx, "w=100", "jpg", source)
+	if err != nil {
+		t.Errorf("got %v within the budget", err)
+	}
+	_, err = r.FetchDerived(ctx, "w=200", "jpg", source)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v over the budget", err)
+	}
+}
+
+func TestDerivedBudgetListedLazily(t *testing.T) {
+	defer func(maxBytes int64) { DerivedCacheMaxBytes = maxBytes }(DerivedCacheMaxBytes)
+	DerivedCacheMaxBytes = 20
+
+	ctx := context.Background()
+	r := &KinuResource{Category: "derived", Id: "lazy"}
+	source := putMiddleImage(t, r, "middle")
+
+	store := func(geometry string) bool {
+		err := r.StoreDerived(ctx, geometry, "jpg", []byte("resized"), "image/jpeg", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.FetchDerived(ctx, geometry, "jpg", source)
+		return err == nil
+	}
+
+	if !store("w=100") {
+		t.Errorf("not stored within the budget")
+	}
+
+	// stored by another process, which is not seen until the usage is listed again.
+	putObject(t, r.BasePath()+"/"+DERIVED_FILENAME_PREFIX+"other.jpg", "other resized", "image/jpeg", map[string]string{})
+	if !store("w=200") {
+		t.Errorf("not stored within the budget of the listed usage")
+	}
+
+	derivedUsages[r.BasePath()].listedAt = time.Now().Add(-DERIVED_USAGE_TTL - time.Second)
+	if store("w=300") {
+		t.Errorf("stored over the budget after the usage is listed again")
+	}
+
+	err := deleteDerived(ctx, r.BasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store("w=400") {
+		t.Errorf("not stored after derived images are deleted")
+	}
+}
+
+func TestDeleteDerived(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "derived", Id: "delete"}
+	source := putMiddleImage(t, r, "middle")
+
+	err := r.StoreDerived(ctx, "w=100", "jpg", []byte("resized"), "image/jpeg", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deleteDerived(ctx, r.BasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.FetchDerived(ctx, "w=100", "jpg", source)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v after deleted", err)
+	}
+	if _, err := r.Fetch(ctx, &resizer.Geometry{Width: 100}); err != nil {
+		t.Errorf("middle image is deleted: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,17 +40,17 @@ func (r *KinuResource) BasePath() string {
 	return fmt.Sprintf("%s/%s", r.Category, r.Id)
 }
 
-func (r *KinuResource) Fetch(geo *resizer.Geometry) (*Image, error) {
+func (r *KinuResource) Fetch(ctx context.Context, geo *resizer.Geometry) (*Image, error) {
 	var middleImageSize string
 	if geo.NeedsOriginalImage {
 		middleImageSize = "original"
 	} else if len(geo.MiddleImageSize) != 0 {
 		middleImageSize = geo.MiddleImageSize
-	} else if geo.Height <= 1000 && geo.Width <= 1000 {
+	} else if width, height := geo.ScaledSize(); height <= 1000 && width <= 1000 {
 		middleImageSize = "1000"
-	} else if geo.Height <= 2000 && geo.Width <= 2000 {
+	} else if height <= 2000 && width <= 2000 {
 		middleImageSize = "2000"
-	} else if geo.Height <= 3000 && geo.Width <= 3000 {
+	} else if height <= 3000 && width <= 3000 {
 		middleImageSize = "3000"
 	} else {
 		middleImageSize = "original"
@@ -59,48 +60,58 @@ func (r *KinuResource) Fetch(geo *resizer.Geometry) (*Image, error) {
 
 	st, err := storage.Open()
 	if err != nil {
-		return image, logger.ErrorDebug(err)
+		return image, logger.ErrorDebugContext(ctx, err)
 	}
 
-	obj, err := st.Fetch(r.FilePath(middleImageSize))
+	obj, err := fetchObject(ctx, st, r.FilePath(middleImageSize))
 	if err != nil {
-		return image, logger.ErrorDebug(err)
+		return image, logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.Body = obj.Body
+	image.Version = obj.Version
+	image.LastModified = obj.LastModified
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"metadata": obj.Metadata,
 	}).Debug("metadata")
 
 	image.Height, err = strconv.Atoi(obj.Metadata["Height"])
 	if err != nil {
-		logger.ErrorDebug(err)
+		logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.Width, err = strconv.Atoi(obj.Metadata["Width"])
 	if err != nil {
-		logger.ErrorDebug(err)
+		logger.ErrorDebugContext(ctx, err)
 	}
 
 	image.ContentType = obj.Metadata["Content-Type"]
+	image.FocalPoint = focalPointOf(obj.Metadata)
+	setOriginalSize(image, obj.Metadata)
+	setRotation(image, obj.Metadata)
 
 	return image, nil
 }
 
-func (r *KinuResource) MoveTo(category, id string) error {
+func (r *KinuResource) MoveTo(ctx context.Context, category, id string) error {
 	st, err := storage.Open()
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
-	items, err := st.List(r.BasePath())
+	items, err := st.List(ctx, r.BasePath())
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	moveToResource := New(category, id)
 
+	err = deleteDerived(ctx, moveToResource.BasePath())
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
 	wg := sync.WaitGroup{}
 	errs := make(chan error, len(items))
 	for _, item := range items {
@@ -109,18 +120,18 @@ func (r *KinuResource) MoveTo(category, id string) error {
 			defer wg.Done()
 			st, err := storage.Open()
 			if err != nil {
-				errs <- logger.ErrorDebug(err)
+				errs <- logger.ErrorDebugContext(ctx, err)
 				return
 			}
 
 			if kinuImageFilePathRegexp.MatchString(item.Key()) {
-				err = st.Move(item.Key(), moveToResource.FilePath(item.ImageSize()))
+				err = st.Move(ctx, item.Key(), moveToResource.FilePath(item.ImageSize()))
 			} else {
-				err = st.Move(item.Key(), moveToResource.BasePath()+"/"+item.Filename())
+				err = st.Move(ctx, item.Key(), moveToResource.BasePath()+"/"+item.Filename())
 			}
 
 			if err != nil {
-				errs <- logger.ErrorDebug(err)
+				errs <- logger.ErrorDebugContext(ctx, err)
 				return
 			}
 
@@ -145,7 +156,7 @@ func (r *KinuResource) MoveTo(category, id string) error {
 	return nil
 }
 
-func (r *KinuResource) Store(file io.ReadSeeker) error {
+func (r *KinuResource) Store(ctx context.Context, file io.ReadSeeker, focalPoint *resizer.FocalPoint) error {
 	imageData, err := ioutil.ReadAll(file)
 	if err != nil {
 		return &ErrStore{Message: "invalid file"}
@@ -170,6 +181,12 @@ func (r *KinuResource) Store(file io.ReadSeeker) error {
 		return &ErrStore{Message: "unsupported filetype, supported jpg or png or gif or pdf"}
 	}
 
+	err = deleteDerived(ctx, r.BasePath())
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	metadata := imageMetadata(imageData, focalPoint)
 	uploaders := make([]uploader.Uploader, 0)
 	for _, size := range resizer.MiddleImageSizes {
 		uploader := &uploader.ImageUploader{
@@ -178,6 +195,7 @@ func (r *KinuResource) Store(file io.ReadSeeker) error {
 			UploadSize:  size,
 			ContentType: contentType,
 			Ext:         ext,
+			Metadata:    metadata,
 		}
 		uploaders = append(uploaders, uploader)
 	}
@@ -187,5 +205,15 @@ func (r *KinuResource) Store(file io.ReadSeeker) error {
 		},
 	)
 
-	return uploader.Upload(uploaders)
+	return uploader.Upload(ctx, uploaders)
+}
+
+func (r *KinuResource) Delete(ctx context.Context) error {
+	return deleteAll(ctx, r.BasePath())
+}
+
+func (r *KinuResource) Info(ctx context.Context) (*ImageInfo, error) {
+	return buildImageInfo(ctx, r.Category, r.Id, r.BasePath(), func(item storage.StorageItem) bool {
+		return kinuImageFilePathRegexp.MatchString(item.Key())
+	})
 }
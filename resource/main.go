@@ -1,31 +1,96 @@
 package resource
 
 import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/exif"
+	"github.com/tokubai/kinu/flight"
+	"github.com/tokubai/kinu/logger"
 	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+	_ "golang.org/x/image/bmp"
 )
 
 var (
 	ValidExtensions      = []string{"jpg", "jpeg", "png", "webp", "gif"}
 	selectedResourceType string
+
+	fetchGroup flight.Group
+)
+
+const (
+	FOCAL_X_METADATA_KEY = "Focal-X"
+	FOCAL_Y_METADATA_KEY = "Focal-Y"
+
+	ORIGINAL_WIDTH_METADATA_KEY  = "Original-Width"
+	ORIGINAL_HEIGHT_METADATA_KEY = "Original-Height"
 )
 
 type Resource interface {
 	FilePath(size string) string
 	BasePath() string
-	Fetch(geo *resizer.Geometry) (*Image, error)
-	MoveTo(category, id string) error
-	Store(file io.ReadSeeker) error
+	Fetch(ctx context.Context, geo *resizer.Geometry) (*Image, error)
+	MoveTo(ctx context.Context, category, id string) error
+	Store(ctx context.Context, file io.ReadSeeker, focalPoint *resizer.FocalPoint) error
+	Delete(ctx context.Context) error
+	Info(ctx context.Context) (*ImageInfo, error)
+	FetchDerived(ctx context.Context, geometry string, ext string, source *Image) (*Image, error)
+	StoreDerived(ctx context.Context, geometry string, ext string, resized []byte, contentType string, source *Image) error
+	FetchSmartCrop(ctx context.Context, width int, height int, source *Image) (*resizer.FocalPoint, error)
+	StoreSmartCrop(ctx context.Context, width int, height int, focalPoint *resizer.FocalPoint, source *Image) error
+	Rotate(ctx context.Context, degrees int) error
 }
 
 type Image struct {
-	Width       int
-	Height      int
-	ContentType string
-	Body        []byte
+	Width        int
+	Height       int
+	ContentType  string
+	Body         []byte
+	Version      string
+	LastModified time.Time
+	FocalPoint   *resizer.FocalPoint
+
+	// OriginalWidth and OriginalHeight are of the uploaded image, same as Width and Height
+	// when images were uploaded without them.
+	OriginalWidth  int
+	OriginalHeight int
+
+	// Rotation is persisted by Rotate, it is applied before the rotation of the geometry.
+	Rotation int
+}
+
+// ImageInfo is stored information of the image without downloading it.
+type ImageInfo struct {
+	Category    string              `json:"category"`
+	Id          string              `json:"id"`
+	Width       int                 `json:"width"`
+	Height      int                 `json:"height"`
+	ContentType string              `json:"content_type"`
+	FileType    string              `json:"filetype"`
+	UploadedAt  time.Time           `json:"uploaded_at"`
+	FocalPoint  *resizer.FocalPoint `json:"focal_point,omitempty"`
+	Rotation    int                 `json:"rotation,omitempty"`
+	Sizes       []*ImageSizeInfo    `json:"sizes"`
+}
+
+type ImageSizeInfo struct {
+	Size   string `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int64  `json:"bytes"`
 }
 
 type ErrMove struct {
@@ -46,6 +111,19 @@ func (e *ErrAttachFromSandbox) Error() string {
 	return messages
 }
 
+type ErrDelete struct {
+	error
+	Errors []error
+}
+
+func (e *ErrDelete) Error() string {
+	messages := "Delete error. cause, "
+	for i, err := range e.Errors {
+		messages = messages + strconv.Itoa(i+1) + ". " + err.Error() + "  "
+	}
+	return messages
+}
+
 type ErrStore struct {
 	error
 	Message string
@@ -74,3 +152,194 @@ func New(category string, id string) Resource {
 		}
 	}
 }
+
+// deleteAll removes all objects under the base path, middle images, originals, metadata and filetype markers.
+// returns storage.ErrImageNotFound when there is nothing to delete.
+func deleteAll(ctx context.Context, basePath string) error {
+	st, err := storage.Open()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	items, err := st.List(ctx, basePath+"/")
+	if err == storage.ErrImageNotFound {
+		return err
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	if len(items) == 0 {
+		return storage.ErrImageNotFound
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(items))
+	for _, item := range items {
+		wg.Add(1)
+		go func(item storage.StorageItem) {
+			defer wg.Done()
+			err := st.Delete(ctx, item.Key())
+			// metadata files may be deleted with the image.
+			if err != nil && err != storage.ErrImageNotFound {
+				errs <- logger.ErrorDebugContext(ctx, err)
+				return
+			}
+			errs <- nil
+		}(item)
+	}
+	wg.Wait()
+
+	close(errs)
+
+	errors := make([]error, 0)
+	for err := range errs {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if len(errors) != 0 {
+		return &ErrDelete{Errors: errors}
+	}
+
+	return nil
+}
+
+// buildImageInfo collects metadata of the stored images under the base path,
+// width, height and upload time are of the original image when it exists.
+func buildImageInfo(ctx context.Context, category, id, basePath string, isImage func(item storage.StorageItem) bool) (*ImageInfo, error) {
+	st, err := storage.Open()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	items, err := st.List(ctx, basePath+"/")
+	if err == storage.ErrImageNotFound {
+		return nil, err
+	} else if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	info := &ImageInfo{Category: category, Id: id, Sizes: make([]*ImageSizeInfo, 0)}
+	images := make(map[string]storage.StorageItem)
+	for _, item := range items {
+		if strings.HasPrefix(item.Filename(), "filetype.") && !strings.HasSuffix(item.Filename(), ".metadata") {
+			info.FileType = item.Extension()
+		} else if isImage(item) {
+			// keep the latest one when the size is uploaded several times.
+			if image, ok := images[item.ImageSize()]; !ok || image.Key() < item.Key() {
+				images[item.ImageSize()] = item
+			}
+		}
+	}
+
+	if len(images) == 0 {
+		return nil, storage.ErrImageNotFound
+	}
+
+	var primary storage.StorageItem
+	var primaryMetadata map[string]string
+	for size, item := range images {
+		metadata, err := st.FetchMetadata(ctx, item.Key())
+		if err != nil {
+			return nil, logger.ErrorDebugContext(ctx, err)
+		}
+
+		sizeInfo := &ImageSizeInfo{Size: size, Bytes: item.Size()}
+		sizeInfo.Width, _ = strconv.Atoi(metadata["Width"])
+		sizeInfo.Height, _ = strconv.Atoi(metadata["Height"])
+		info.Sizes = append(info.Sizes, sizeInfo)
+
+		if primary == nil || size == "original" || primary.ImageSize() != "original" && sizeInfo.Width*sizeInfo.Height > info.Width*info.Height {
+			primary, primaryMetadata = item, metadata
+			info.Width, info.Height = sizeInfo.Width, sizeInfo.Height
+		}
+	}
+
+	info.ContentType = primaryMetadata["Content-Type"]
+	info.FocalPoint = focalPointOf(primaryMetadata)
+	info.Rotation = rotationOf(primaryMetadata)
+	info.UploadedAt = primary.LastModified()
+
+	sort.Slice(info.Sizes, func(i, j int) bool {
+		return middleImageSizeOrder(info.Sizes[i].Size) < middleImageSizeOrder(info.Sizes[j].Size)
+	})
+
+	return info, nil
+}
+
+// focalPointMetadata is stored with images uploaded with the focal point.
+func focalPointMetadata(focalPoint *resizer.FocalPoint) map[string]string {
+	if focalPoint == nil {
+		return map[string]string{}
+	}
+	return map[string]string{
+		FOCAL_X_METADATA_KEY: strconv.FormatFloat(focalPoint.X, 'f', -1, 64),
+		FOCAL_Y_METADATA_KEY: strconv.FormatFloat(focalPoint.Y, 'f', -1, 64),
+	}
+}
+
+// imageMetadata is stored with all sizes of the uploaded image, the original size is omitted
+// when the image can not be decoded without the resize engine, e.g. pdf.
+// the original size is of the image displayed upright, as resized images are auto oriented.
+func imageMetadata(imageData []byte, focalPoint *resizer.FocalPoint) map[string]string {
+	metadata := focalPointMetadata(focalPoint)
+	size, _, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err == nil {
+		width, height := size.Width, size.Height
+		// orientations from 5 to 8 are transposed or rotated by 90 degrees.
+		if exif.Orientation(imageData) >= 5 {
+			width, height = height, width
+		}
+		metadata[ORIGINAL_WIDTH_METADATA_KEY] = strconv.Itoa(width)
+		metadata[ORIGINAL_HEIGHT_METADATA_KEY] = strconv.Itoa(height)
+	}
+	return metadata
+}
+
+// setOriginalSize falls back to the size of the fetched image when the original size is not stored.
+func setOriginalSize(img *Image, metadata map[string]string) {
+	width, widthErr := strconv.Atoi(metadata[ORIGINAL_WIDTH_METADATA_KEY])
+	height, heightErr := strconv.Atoi(metadata[ORIGINAL_HEIGHT_METADATA_KEY])
+	if widthErr != nil || heightErr != nil {
+		width, height = img.Width, img.Height
+	}
+	img.OriginalWidth, img.OriginalHeight = width, height
+}
+
+// focalPointOf returns nil when the image was uploaded without the focal point.
+func focalPointOf(metadata map[string]string) *resizer.FocalPoint {
+	focalPoint, err := resizer.ParseFocalPoint(metadata[FOCAL_X_METADATA_KEY], metadata[FOCAL_Y_METADATA_KEY])
+	if err != nil {
+		return nil
+	}
+	return focalPoint
+}
+
+func middleImageSizeOrder(size string) int {
+	for i, s := range resizer.MiddleImageSizes {
+		if s == size {
+			return i
+		}
+	}
+	return len(resizer.MiddleImageSizes)
+}
+
+// fetchObject coalesces concurrent fetches of the same key into one storage fetch, which is canceled
+// when all callers are canceled. the fetched object is shared by callers and must not be modified.
+func fetchObject(ctx context.Context, st storage.Storage, key string) (*storage.Object, error) {
+	obj, err, shared := fetchGroup.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return st.Fetch(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if shared {
+		logger.WithContext(ctx).WithFields(logrus.Fields{
+			"key": key,
+		}).Debug("shared storage fetch")
+	}
+
+	return obj.(*storage.Object), nil
+}
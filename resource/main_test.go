@@ -0,0 +1,174 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/tokubai/kinu/storage"
+)
+
+func putObject(t *testing.T, key string, body string, contentType string, metadata map[string]string) {
+	st, err := storage.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.PutFromBlob(context.Background(), key, []byte(body), contentType, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildImageInfo(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "info", Id: "1"}
+	putObject(t, r.FilePath("original"), "original", "image/png", map[string]string{
+		"Width": "1500", "Height": "1200", FOCAL_X_METADATA_KEY: "0.2", FOCAL_Y_METADATA_KEY: "0.3", ROTATION_METADATA_KEY: "90",
+	})
+	putObject(t, r.FilePath("1000"), "1000", "image/png", map[string]string{"Width": "1000", "Height": "800"})
+	putObject(t, r.FilePath("2000"), "2000", "image/png", map[string]string{"Width": "1500", "Height": "1200"})
+	putObject(t, r.BasePath()+"/filetype.png", "", "text/plain", map[string]string{})
+	putObject(t, r.BasePath()+"/"+DERIVED_FILENAME_PREFIX+"0123.jpg", "derived", "image/jpeg", map[string]string{})
+
+	info, err := r.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Category != "info" || info.Id != "1" || info.FileType != "png" || info.ContentType != "image/png" {
+		t.Errorf("got %+v", info)
+	}
+	if info.Width != 1500 || info.Height != 1200 {
+		t.Errorf("got %dx%d, want the original size", info.Width, info.Height)
+	}
+	if info.FocalPoint == nil || info.FocalPoint.X != 0.2 || info.FocalPoint.Y != 0.3 {
+		t.Errorf("got focal point %+v", info.FocalPoint)
+	}
+	if info.Rotation != 90 {
+		t.Errorf("got rotation %d", info.Rotation)
+	}
+
+	sizes := []string{}
+	for _, size := range info.Sizes {
+		sizes = append(sizes, size.Size)
+	}
+	if len(sizes) != 3 || sizes[0] != "original" || sizes[1] != "1000" || sizes[2] != "2000" {
+		t.Errorf("got sizes %v", sizes)
+	}
+	if info.Sizes[1].Width != 1000 || info.Sizes[1].Height != 800 || info.Sizes[1].Bytes != 4 {
+		t.Errorf("got %+v", info.Sizes[1])
+	}
+}
+
+func TestBuildImageInfoWithoutOriginal(t *testing.T) {
+	r := &KinuResource{Category: "info", Id: "2"}
+	putObject(t, r.FilePath("1000"), "1000", "image/jpeg", map[string]string{"Width": "1000", "Height": "750"})
+	putObject(t, r.FilePath("2000"), "2000", "image/jpeg", map[string]string{"Width": "2000", "Height": "1500"})
+
+	info, err := r.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 2000 || info.Height != 1500 {
+		t.Errorf("got %dx%d, want the largest size", info.Width, info.Height)
+	}
+}
+
+func TestBuildImageInfoNotFound(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := (&KinuResource{Category: "info", Id: "missing"}).Info(ctx)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v", err)
+	}
+
+	r := &KinuResource{Category: "info", Id: "derived-only"}
+	putObject(t, r.BasePath()+"/"+DERIVED_FILENAME_PREFIX+"0123.jpg", "derived", "image/jpeg", map[string]string{})
+	_, err = r.Info(ctx)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v without images", err)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "delete", Id: "1"}
+	putObject(t, r.FilePath("original"), "original", "image/png", map[string]string{"Width": "10", "Height": "10"})
+	putObject(t, r.FilePath("1000"), "1000", "image/png", map[string]string{"Width": "10", "Height": "10"})
+	putObject(t, r.BasePath()+"/filetype.png", "", "text/plain", map[string]string{})
+
+	err := r.Delete(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Info(ctx)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v after deleted", err)
+	}
+
+	// deleting again is not found, so that retries of deletes are told apart from errors.
+	err = r.Delete(ctx)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v for the deleted image", err)
+	}
+
+	err = (&KinuResource{Category: "delete", Id: "missing"}).Delete(ctx)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v for the missing image", err)
+	}
+}
+
+// jpegWithOrientation encodes a jpeg of the size stored with the EXIF orientation.
+func jpegWithOrientation(t *testing.T, width, height, orientation int) []byte {
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("II")
+	binary.Write(tiff, binary.LittleEndian, uint16(42))
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+	binary.Write(tiff, binary.LittleEndian, uint16(1))
+	binary.Write(tiff, binary.LittleEndian, uint16(0x0112))
+	binary.Write(tiff, binary.LittleEndian, uint16(3))
+	binary.Write(tiff, binary.LittleEndian, uint32(1))
+	binary.Write(tiff, binary.LittleEndian, uint16(orientation))
+	binary.Write(tiff, binary.LittleEndian, uint16(0))
+	binary.Write(tiff, binary.LittleEndian, uint32(0))
+	exif := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := &bytes.Buffer{}
+	out.Write(buf.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(len(exif)+2))
+	out.Write(exif)
+	out.Write(buf.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestImageMetadataOrientation(t *testing.T) {
+	cases := []struct {
+		orientation   int
+		width, height string
+	}{
+		{1, "40", "30"},
+		{3, "40", "30"},
+		{5, "30", "40"},
+		{6, "30", "40"},
+		{8, "30", "40"},
+	}
+
+	for _, c := range cases {
+		metadata := imageMetadata(jpegWithOrientation(t, 40, 30, c.orientation), nil)
+		if metadata[ORIGINAL_WIDTH_METADATA_KEY] != c.width || metadata[ORIGINAL_HEIGHT_METADATA_KEY] != c.height {
+			t.Errorf("orientation %d: got %sx%s, want %sx%s", c.orientation,
+				metadata[ORIGINAL_WIDTH_METADATA_KEY], metadata[ORIGINAL_HEIGHT_METADATA_KEY], c.width, c.height)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+// The rotation of the image is persisted in metadata of all sizes, the stored images are not rotated,
+// so that it is applied to every resized image and can be changed or cleared any time.
+const ROTATION_METADATA_KEY = "Rotation"
+
+var (
+	ErrRotationNotSupported = errors.New("rotation is not supported in backward compatible mode.")
+)
+
+// rotationOf returns 0 when the rotation is not set.
+func rotationOf(metadata map[string]string) int {
+	degrees, err := strconv.Atoi(metadata[ROTATION_METADATA_KEY])
+	if err != nil || !resizer.IsValidRotation(degrees) {
+		return 0
+	}
+	return degrees
+}
+
+// setRotation sets the rotation of the fetched image, the version is not changed by it,
+// because only metadata is updated, so keys of resized images include the rotation separately.
+func setRotation(img *Image, metadata map[string]string) {
+	img.Rotation = rotationOf(metadata)
+}
+
+// sourceFields are the version and the rotation of the image in keys of images resized from it,
+// the rotation is left out when it is not set, so that keys of images never rotated are unchanged.
+func sourceFields(img *Image) []string {
+	if img.Rotation == 0 {
+		return []string{img.Version}
+	}
+	return []string{img.Version, "r" + strconv.Itoa(img.Rotation)}
+}
+
+// Rotate updates the rotation in metadata of all sizes of the image without rewriting them, 0 clears it.
+// derived images and smart crop windows are deleted, because they are of the previous rotation.
+func (r *KinuResource) Rotate(ctx context.Context, degrees int) error {
+	st, err := storage.Open()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	items, err := st.List(ctx, r.BasePath()+"/")
+	if err == storage.ErrImageNotFound {
+		return err
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	found := false
+	for _, item := range items {
+		if !kinuImageFilePathRegexp.MatchString(item.Key()) {
+			continue
+		}
+		found = true
+
+		metadata, err := st.FetchMetadata(ctx, item.Key())
+		if err != nil {
+			return logger.ErrorDebugContext(ctx, err)
+		}
+
+		if degrees == 0 {
+			delete(metadata, ROTATION_METADATA_KEY)
+		} else {
+			metadata[ROTATION_METADATA_KEY] = strconv.Itoa(degrees)
+		}
+
+		err = st.UpdateMetadata(ctx, item.Key(), metadata)
+		if err != nil {
+			return logger.ErrorDebugContext(ctx, err)
+		}
+	}
+
+	if !found {
+		return storage.ErrImageNotFound
+	}
+
+	return deleteDerived(ctx, r.BasePath())
+}
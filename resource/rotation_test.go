@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "rotation", Id: "1"}
+	putObject(t, r.FilePath("original"), "original", "image/png", map[string]string{"Width": "1500", "Height": "1200"})
+	source := putMiddleImage(t, r, "middle")
+
+	err := r.StoreDerived(ctx, "w=100", "jpg", []byte("resized"), "image/jpeg", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Rotate(ctx, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := r.Fetch(ctx, &resizer.Geometry{Width: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rotated.Body) != "middle" || rotated.ContentType != "image/jpeg" || rotated.Width != 1000 || rotated.Height != 800 {
+		t.Errorf("got %q of %s %dx%d, the image is rewritten", rotated.Body, rotated.ContentType, rotated.Width, rotated.Height)
+	}
+	if rotated.Rotation != 90 {
+		t.Errorf("got rotation %d", rotated.Rotation)
+	}
+	// only metadata is updated, the rotation is keyed separately.
+	if rotated.Version != source.Version {
+		t.Errorf("got version %s, want %s", rotated.Version, source.Version)
+	}
+	if r.DerivedFilePath("w=100", "jpg", rotated) == r.DerivedFilePath("w=100", "jpg", source) {
+		t.Errorf("derived image of the rotated image is keyed as the previous one")
+	}
+	if r.SmartCropFilePath(16, 9, rotated) == r.SmartCropFilePath(16, 9, source) {
+		t.Errorf("smart crop window of the rotated image is keyed as the previous one")
+	}
+
+	_, err = r.FetchDerived(ctx, "w=100", "jpg", source)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v, derived images are not deleted", err)
+	}
+
+	info, err := r.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Rotation != 90 || info.ContentType != "image/png" {
+		t.Errorf("got %+v", info)
+	}
+
+	err = r.Rotate(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleared, err := r.Fetch(ctx, &resizer.Geometry{Width: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Rotation != 0 || r.DerivedFilePath("w=100", "jpg", cleared) != r.DerivedFilePath("w=100", "jpg", source) {
+		t.Errorf("got rotation %d after cleared", cleared.Rotation)
+	}
+}
+
+func TestRotateNotFound(t *testing.T) {
+	err := (&KinuResource{Category: "rotation", Id: "missing"}).Rotate(context.Background(), 90)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v", err)
+	}
+}
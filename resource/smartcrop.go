@@ -0,0 +1,89 @@
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tokubai/kinu/config"
+	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+// Smart crop windows are cached as the focal point in metadata of an empty object per aspect ratio and source image,
+// e.g. :image_type/:id/smartcrop.16x9.:hash for w=1600,h=900, so that every size and format of the aspect ratio
+// is cropped the same without analyzing the image again. the hash is of the version and the rotation of the analyzed
+// image like derived images, so that windows stored by an analysis in flight of the previous upload are never used.
+const SMART_CROP_FILENAME_PREFIX = "smartcrop."
+
+var (
+	SmartCropCacheEnabled bool
+)
+
+func init() {
+	if os.Getenv("KINU_SMART_CROP_CACHE") != "true" {
+		return
+	}
+
+	if config.BackwardCompatibleMode {
+		logger.Warn("smart crop cache is not supported in backward compatible mode.")
+		return
+	}
+
+	SmartCropCacheEnabled = true
+	logger.Info("enable smart crop cache")
+}
+
+func IsSmartCropCacheEnabled() bool {
+	return SmartCropCacheEnabled
+}
+
+func isSmartCropItem(item storage.StorageItem) bool {
+	return strings.HasPrefix(item.Filename(), SMART_CROP_FILENAME_PREFIX)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (r *KinuResource) SmartCropFilePath(width int, height int, source *Image) string {
+	d := gcd(width, height)
+	sum := sha256.Sum256([]byte(strings.Join(sourceFields(source), "\n")))
+	return r.BasePath() + "/" + SMART_CROP_FILENAME_PREFIX + strconv.Itoa(width/d) + "x" + strconv.Itoa(height/d) + "." + hex.EncodeToString(sum[:8])
+}
+
+// FetchSmartCrop returns the cached focal point of the aspect ratio analyzed from the source image,
+// storage.ErrImageNotFound when it is not cached.
+func (r *KinuResource) FetchSmartCrop(ctx context.Context, width int, height int, source *Image) (*resizer.FocalPoint, error) {
+	st, err := storage.Open()
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	obj, err := fetchObject(ctx, st, r.SmartCropFilePath(width, height, source))
+	if err != nil {
+		return nil, err
+	}
+
+	focalPoint := focalPointOf(obj.Metadata)
+	if focalPoint == nil {
+		return nil, storage.ErrImageNotFound
+	}
+	return focalPoint, nil
+}
+
+func (r *KinuResource) StoreSmartCrop(ctx context.Context, width int, height int, focalPoint *resizer.FocalPoint, source *Image) error {
+	st, err := storage.Open()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	return st.PutFromBlob(ctx, r.SmartCropFilePath(width, height, source), []byte{}, "plain/text", focalPointMetadata(focalPoint))
+}
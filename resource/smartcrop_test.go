@@ -0,0 +1,60 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tokubai/kinu/resizer"
+	"github.com/tokubai/kinu/storage"
+)
+
+func TestSmartCropStoreAndFetch(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "smartcrop", Id: "store"}
+	source := putMiddleImage(t, r, "middle")
+
+	_, err := r.FetchSmartCrop(ctx, 1600, 900, source)
+	if err != storage.ErrImageNotFound {
+		t.Fatalf("got %v before stored", err)
+	}
+
+	err = r.StoreSmartCrop(ctx, 1600, 900, &resizer.FocalPoint{X: 0.25, Y: 0.5}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cached per aspect ratio, every size of 16:9 shares the window.
+	focalPoint, err := r.FetchSmartCrop(ctx, 320, 180, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *focalPoint != (resizer.FocalPoint{X: 0.25, Y: 0.5}) {
+		t.Errorf("got %+v", focalPoint)
+	}
+
+	_, err = r.FetchSmartCrop(ctx, 100, 100, source)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v for another aspect ratio", err)
+	}
+}
+
+func TestSmartCropOfReplacedSource(t *testing.T) {
+	ctx := context.Background()
+	r := &KinuResource{Category: "smartcrop", Id: "replaced"}
+	oldSource := putMiddleImage(t, r, "old middle")
+	newSource := putMiddleImage(t, r, "new middle image")
+	if newSource.Version == oldSource.Version {
+		t.Fatalf("version %s is not changed", newSource.Version)
+	}
+
+	// stored by an analysis of the old source in flight after the new source is uploaded.
+	err := r.StoreSmartCrop(ctx, 1600, 900, &resizer.FocalPoint{X: 0.25, Y: 0.5}, oldSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.FetchSmartCrop(ctx, 1600, 900, newSource)
+	if err != storage.ErrImageNotFound {
+		t.Errorf("got %v, window of the old source is used", err)
+	}
+}
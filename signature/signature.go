@@ -0,0 +1,97 @@
+// Package signature signs image urls with HMAC-SHA256, so that only urls issued by applications are resized.
+//
+// The signature covers the url path and the expiry, and is passed as query parameters:
+//
+//	/images/foods/w=280,h=300,c=true/1.jpg?e=1700000000&s=<signature>
+//
+// `e` is unix time and optional, urls without `e` never expire.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	SIGNATURE_PARAM = "s"
+	EXPIRES_PARAM   = "e"
+)
+
+var (
+	ErrSignatureRequired = errors.New("signature is required.")
+	ErrInvalidSignature  = errors.New("invalid signature.")
+	ErrInvalidExpires    = errors.New("invalid signature expires.")
+	ErrSignatureExpired  = errors.New("signature is expired.")
+)
+
+func message(path string, expires int64) string {
+	if expires == 0 {
+		return path
+	}
+	return path + "?" + EXPIRES_PARAM + "=" + strconv.FormatInt(expires, 10)
+}
+
+// Sign returns the signature of the path, expires is unix time and 0 means no expiry.
+func Sign(secret string, path string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message(path, expires)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignQuery sets the signature and the expiry to the query.
+func SignQuery(query url.Values, secret string, path string, expires int64) {
+	query.Del(EXPIRES_PARAM)
+	if expires != 0 {
+		query.Set(EXPIRES_PARAM, strconv.FormatInt(expires, 10))
+	}
+	query.Set(SIGNATURE_PARAM, Sign(secret, path, expires))
+}
+
+// Expires returns the expiry in the query, 0 when it is not set.
+func Expires(query url.Values) (int64, error) {
+	e := query.Get(EXPIRES_PARAM)
+	if len(e) == 0 {
+		return 0, nil
+	}
+	expires, err := strconv.ParseInt(e, 10, 64)
+	if err != nil || expires <= 0 {
+		return 0, ErrInvalidExpires
+	}
+	return expires, nil
+}
+
+// Verify checks the signature in the query by any of secrets, so that secrets can be rotated
+// by adding a new secret before applications start to use it.
+func Verify(secrets []string, path string, query url.Values, now time.Time) error {
+	s := query.Get(SIGNATURE_PARAM)
+	if len(s) == 0 {
+		return ErrSignatureRequired
+	}
+
+	expires, err := Expires(query)
+	if err != nil {
+		return err
+	}
+
+	actual, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	for _, secret := range secrets {
+		expected, _ := base64.RawURLEncoding.DecodeString(Sign(secret, path, expires))
+		if hmac.Equal(actual, expected) {
+			if expires != 0 && now.Unix() > expires {
+				return ErrSignatureExpired
+			}
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
@@ -0,0 +1,53 @@
+package signature
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+const TEST_PATH = "/images/foods/w=280,h=300,q=85,c=true/1.jpg"
+
+func signedQuery(secret string, path string, expires int64) url.Values {
+	query := url.Values{}
+	SignQuery(query, secret, path, expires)
+	return query
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secrets := []string{"new-secret", "old-secret"}
+
+	tampered := signedQuery("new-secret", TEST_PATH, 0)
+	tampered.Set(SIGNATURE_PARAM, Sign("new-secret", "/images/foods/w=9999,h=9999/1.jpg", 0))
+
+	extended := signedQuery("new-secret", TEST_PATH, now.Unix()+60)
+	extended.Set(EXPIRES_PARAM, "1800000000")
+
+	cases := []struct {
+		name  string
+		path  string
+		query url.Values
+		want  error
+	}{
+		{"no expiry", TEST_PATH, signedQuery("new-secret", TEST_PATH, 0), nil},
+		{"not expired", TEST_PATH, signedQuery("new-secret", TEST_PATH, now.Unix()+60), nil},
+		{"expires now", TEST_PATH, signedQuery("new-secret", TEST_PATH, now.Unix()), nil},
+		{"rotated secret", TEST_PATH, signedQuery("old-secret", TEST_PATH, 0), nil},
+		{"expired", TEST_PATH, signedQuery("new-secret", TEST_PATH, now.Unix()-1), ErrSignatureExpired},
+		{"unknown secret", TEST_PATH, signedQuery("unknown", TEST_PATH, 0), ErrInvalidSignature},
+		{"other path", "/images/foods/w=9999,h=9999/1.jpg", signedQuery("new-secret", TEST_PATH, 0), ErrInvalidSignature},
+		{"tampered signature", TEST_PATH, tampered, ErrInvalidSignature},
+		{"extended expiry", TEST_PATH, extended, ErrInvalidSignature},
+		{"broken signature", TEST_PATH, url.Values{SIGNATURE_PARAM: {"%%%"}}, ErrInvalidSignature},
+		{"broken expiry", TEST_PATH, url.Values{SIGNATURE_PARAM: {"abc"}, EXPIRES_PARAM: {"tomorrow"}}, ErrInvalidExpires},
+		{"no signature", TEST_PATH, url.Values{}, ErrSignatureRequired},
+	}
+
+	for _, c := range cases {
+		err := Verify(secrets, c.path, c.query, now)
+		if err != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
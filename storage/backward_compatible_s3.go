@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
@@ -74,7 +76,7 @@ func (s *BackwardCompatibleS3Storage) BuildKey(key string) string {
 	}
 }
 
-func (s *BackwardCompatibleS3Storage) Fetch(key string) (*Object, error) {
+func (s *BackwardCompatibleS3Storage) Fetch(ctx context.Context, key string) (*Object, error) {
 	key = s.BuildKey(key)
 
 	params := &s3.GetObjectInput{
@@ -82,20 +84,20 @@ func (s *BackwardCompatibleS3Storage) Fetch(key string) (*Object, error) {
 		Key:    aws.String(key),
 	}
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"bucket": s.bucket,
 		"key":    key,
 	}).Debug("start get object from s3")
 
-	resp, err := s.client.GetObject(params)
+	resp, err := s.client.GetObjectWithContext(ctx, params)
 
 	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
 		return nil, ErrImageNotFound
 	} else if err != nil {
-		return nil, logger.ErrorDebug(err)
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"bucket": s.bucket,
 		"key":    key,
 	}).Debug("found object from s3")
@@ -103,27 +105,29 @@ func (s *BackwardCompatibleS3Storage) Fetch(key string) (*Object, error) {
 	defer resp.Body.Close()
 
 	object := &Object{
-		Metadata: make(map[string]string, 0),
+		Metadata:     make(map[string]string, 0),
+		Version:      strings.Trim(aws.StringValue(resp.ETag), `"`),
+		LastModified: aws.TimeValue(resp.LastModified),
 	}
 	for k, v := range resp.Metadata {
 		object.Metadata[k] = *v
 	}
 	object.Body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, logger.ErrorDebug(err)
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 
 	return object, nil
 }
 
-func (s *BackwardCompatibleS3Storage) PutFromBlob(key string, image []byte, contentType string, metadata map[string]string) error {
+func (s *BackwardCompatibleS3Storage) PutFromBlob(ctx context.Context, key string, image []byte, contentType string, metadata map[string]string) error {
 	tmpfile, err := ioutil.TempFile("", "kinu-upload")
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 	_, err = tmpfile.Write(image)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	defer func() {
@@ -131,10 +135,10 @@ func (s *BackwardCompatibleS3Storage) PutFromBlob(key string, image []byte, cont
 		os.Remove(tmpfile.Name())
 	}()
 
-	return s.Put(key, tmpfile, contentType, metadata)
+	return s.Put(ctx, key, tmpfile, contentType, metadata)
 }
 
-func (s *BackwardCompatibleS3Storage) Put(key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
+func (s *BackwardCompatibleS3Storage) Put(ctx context.Context, key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
 	putMetadata := make(map[string]*string, 0)
 	for k, v := range metadata {
 		putMetadata[k] = aws.String(v)
@@ -142,10 +146,10 @@ func (s *BackwardCompatibleS3Storage) Put(key string, imageFile io.ReadSeeker, c
 
 	_, err := imageFile.Seek(0, 0)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
-	_, err = s.client.PutObject(&s3.PutObjectInput{
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(s.BuildKey(key)),
 		ContentType: aws.String(contentType),
@@ -153,56 +157,58 @@ func (s *BackwardCompatibleS3Storage) Put(key string, imageFile io.ReadSeeker, c
 		Metadata:    putMetadata,
 	})
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"bucket": s.bucket,
 		"key":    s.BuildKey(key),
 	}).Debug("put to s3")
 
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	return nil
 }
 
-func (s *BackwardCompatibleS3Storage) List(key string) ([]StorageItem, error) {
-	resp, err := s.client.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(s.BuildKey(key)),
-	})
-
-	if err != nil {
-		return nil, logger.ErrorDebug(err)
-	}
-
-	logger.WithFields(logrus.Fields{
+func (s *BackwardCompatibleS3Storage) List(ctx context.Context, key string) ([]StorageItem, error) {
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"bucket": s.bucket,
 		"key":    s.BuildKey(key),
 	}).Debug("start list object from s3")
 
+	// a response has up to 1000 objects, all pages are listed.
 	items := make([]StorageItem, 0)
-	for _, object := range resp.Contents {
-		logger.WithFields(logrus.Fields{
-			"key": &object.Key,
-		}).Debug("found object")
-		item := BackwardCompatibleS3StorageItem{Object: object}
-		items = append(items, &item)
+	err := s.client.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.BuildKey(key)),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, object := range page.Contents {
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				"key": &object.Key,
+			}).Debug("found object")
+			item := BackwardCompatibleS3StorageItem{Object: object}
+			items = append(items, &item)
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 
 	return items, nil
 }
 
-func (s *BackwardCompatibleS3Storage) Move(from string, to string) error {
+func (s *BackwardCompatibleS3Storage) Move(ctx context.Context, from string, to string) error {
 	fromKey := s.bucket + "/" + from
 	toKey := s.bucketBasePath + "/" + to
 
-	_, err := s.client.CopyObject(&s3.CopyObjectInput{
+	_, err := s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
 		Bucket:     aws.String(s.bucket),
 		CopySource: aws.String(fromKey),
 		Key:        aws.String(toKey),
 	})
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"from": fromKey,
 		"to":   toKey,
 	}).Debug("move s3 object start")
@@ -210,9 +216,9 @@ func (s *BackwardCompatibleS3Storage) Move(from string, to string) error {
 	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
 		return ErrImageNotFound
 	} else if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
-	_, err = s.client.DeleteObject(&s3.DeleteObjectInput{
+	_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(from),
 	})
@@ -220,7 +226,87 @@ func (s *BackwardCompatibleS3Storage) Move(from string, to string) error {
 	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
 		return ErrImageNotFound
 	} else if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	return nil
+}
+
+// Delete removes the object, key is a full key in the bucket same as Move.
+// S3 does not tell whether the object existed, so deleting a missing object succeeds.
+func (s *BackwardCompatibleS3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"bucket": s.bucket,
+		"key":    key,
+	}).Debug("delete s3 object")
+
+	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
+		return ErrImageNotFound
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	return nil
+}
+
+func (s *BackwardCompatibleS3Storage) FetchMetadata(ctx context.Context, key string) (map[string]string, error) {
+	resp, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
+		return nil, ErrImageNotFound
+	} else if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	metadata := make(map[string]string, 0)
+	for k, v := range resp.Metadata {
+		metadata[k] = *v
+	}
+	if resp.ContentType != nil {
+		metadata["Content-Type"] = *resp.ContentType
+	}
+
+	return metadata, nil
+}
+
+// UpdateMetadata copies the object onto itself with the metadata replaced, the body is not transferred.
+func (s *BackwardCompatibleS3Storage) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	s3Metadata := make(map[string]*string, 0)
+	for k, v := range metadata {
+		if k != "Content-Type" {
+			s3Metadata[k] = aws.String(v)
+		}
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		CopySource:        aws.String(s.bucket + "/" + key),
+		Key:               aws.String(key),
+		Metadata:          s3Metadata,
+		MetadataDirective: aws.String("REPLACE"),
+	}
+	if contentType, ok := metadata["Content-Type"]; ok {
+		input.ContentType = aws.String(contentType)
+	}
+	_, err := s.client.CopyObjectWithContext(ctx, input)
+
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"bucket": s.bucket,
+		"key":    key,
+	}).Debug("update s3 object metadata")
+
+	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
+		return ErrImageNotFound
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	return nil
@@ -260,3 +346,11 @@ func (s *BackwardCompatibleS3StorageItem) ImageSize() string {
 		return "1000"
 	}
 }
+
+func (s *BackwardCompatibleS3StorageItem) Size() int64 {
+	return aws.Int64Value(s.Object.Size)
+}
+
+func (s *BackwardCompatibleS3StorageItem) LastModified() time.Time {
+	return aws.TimeValue(s.Object.LastModified)
+}
@@ -1,26 +1,40 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/config"
 	"github.com/tokubai/kinu/logger"
+	"github.com/tokubai/kinu/metrics"
 )
 
+// Storage operations abort with the error of the context when it is done.
 type Storage interface {
 	Open() error
 
-	Fetch(key string) (*Object, error)
+	Fetch(ctx context.Context, key string) (*Object, error)
 
-	PutFromBlob(key string, image []byte, contentType string, metadata map[string]string) error
-	Put(key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error
+	PutFromBlob(ctx context.Context, key string, image []byte, contentType string, metadata map[string]string) error
+	Put(ctx context.Context, key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error
 
-	List(key string) ([]StorageItem, error)
+	List(ctx context.Context, key string) ([]StorageItem, error)
 
-	Move(from string, to string) error
+	Move(ctx context.Context, from string, to string) error
+
+	// Delete removes the object of the key listed by List, returns ErrImageNotFound when it does not exist.
+	Delete(ctx context.Context, key string) error
+
+	// FetchMetadata returns metadata and Content-Type of the object of the key listed by List without the body.
+	FetchMetadata(ctx context.Context, key string) (map[string]string, error)
+
+	// UpdateMetadata replaces metadata of the object of the key listed by List without rewriting the body,
+	// metadata is in the form of FetchMetadata, its Content-Type is kept as the content type of the object.
+	UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error
 }
 
 type StorageItem interface {
@@ -28,11 +42,17 @@ type StorageItem interface {
 	Filename() string
 	Extension() string
 	ImageSize() string
+	Size() int64
+	LastModified() time.Time
 }
 
 type Object struct {
 	Body     []byte
 	Metadata map[string]string
+
+	// Version changes whenever the object is overwritten.
+	Version      string
+	LastModified time.Time
 }
 
 var (
@@ -52,7 +72,8 @@ var (
 	selectedStorageType   string
 )
 
-func init() {
+// Initialize selects the storage of KINU_STORAGE_TYPE, it must be called before Open.
+func Initialize() {
 	if config.BackwardCompatibleMode {
 		selectedStorageType = "BackwardCompatibleS3"
 	} else {
@@ -78,7 +99,26 @@ func init() {
 	}).Info("setup storage")
 }
 
+// Open returns the storage of KINU_STORAGE_TYPE, wrapped by the disk cache when KINU_DISK_CACHE_DIRECTORY is set.
 func Open() (Storage, error) {
+	st, err := openBackend()
+	if err != nil {
+		metrics.StorageErrors.Inc(selectedStorageType, "open")
+		return nil, err
+	}
+	backend := NewInstrumentedStorage(st, selectedStorageType)
+
+	cache, err := openSharedDiskCache()
+	if err != nil {
+		return nil, logger.ErrorDebug(err)
+	}
+	if cache == nil {
+		return backend, nil
+	}
+	return NewDiskCacheStorage(backend, cache), nil
+}
+
+func openBackend() (Storage, error) {
 	switch selectedStorageType {
 	case "S3":
 		return openS3Storage()
@@ -0,0 +1,391 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tokubai/kinu/logger"
+)
+
+// DiskCache keeps fetched objects on local disk, bounded by total bytes of bodies and expired after ttl.
+// It is shared by DiskCacheStorage wrappers, because storages are opened for each operation.
+type DiskCache struct {
+	directory string
+	maxBytes  int64
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	bytes int64
+	ll    *list.List
+	items map[string]*list.Element
+
+	// generations are incremented by invalidation, objects fetched before it are not stored.
+	// they are counted in buckets of names, so that they are bounded regardless of the number of objects.
+	generations [DISK_CACHE_GENERATION_BUCKETS]uint64
+}
+
+type diskCacheItem struct {
+	name      string
+	size      int64
+	fetchedAt time.Time
+}
+
+// diskCacheMetadata is stored next to the body as :name.metadata
+type diskCacheMetadata struct {
+	Metadata     map[string]string `json:"metadata"`
+	Version      string            `json:"version"`
+	LastModified time.Time         `json:"last_modified"`
+}
+
+// DiskCacheStorage is a read-through cache of Fetch over any storage, writes go to the backend
+// and invalidate cached objects of this process, other processes see them after ttl.
+type DiskCacheStorage struct {
+	Storage
+
+	backend Storage
+	cache   *DiskCache
+}
+
+type keyBuilder interface {
+	BuildKey(key string) string
+}
+
+var (
+	sharedDiskCache     *DiskCache
+	sharedDiskCacheOnce sync.Once
+	sharedDiskCacheErr  error
+)
+
+// openSharedDiskCache opens the disk cache of KINU_DISK_CACHE_DIRECTORY once, nil when it is not set.
+func openSharedDiskCache() (*DiskCache, error) {
+	sharedDiskCacheOnce.Do(func() {
+		directory := os.Getenv("KINU_DISK_CACHE_DIRECTORY")
+		if len(directory) == 0 {
+			return
+		}
+
+		var maxBytes int64 = DEFAULT_DISK_CACHE_MAX_BYTES
+		if v := os.Getenv("KINU_DISK_CACHE_MAX_BYTES"); len(v) != 0 {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				sharedDiskCacheErr = &ErrInvalidStorageOption{Message: "KINU_DISK_CACHE_MAX_BYTES must be integer"}
+				return
+			}
+			maxBytes = n
+		}
+
+		ttl := DEFAULT_DISK_CACHE_TTL
+		if v := os.Getenv("KINU_DISK_CACHE_TTL"); len(v) != 0 {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				sharedDiskCacheErr = &ErrInvalidStorageOption{Message: "KINU_DISK_CACHE_TTL must be duration, e.g. 10m"}
+				return
+			}
+			ttl = d
+		}
+
+		sharedDiskCache, sharedDiskCacheErr = NewDiskCache(directory, maxBytes, ttl)
+		if sharedDiskCacheErr == nil {
+			logger.WithFields(logrus.Fields{
+				"directory": directory,
+				"max_bytes": maxBytes,
+				"ttl":       ttl,
+			}).Info("enable disk cache storage")
+		}
+	})
+	return sharedDiskCache, sharedDiskCacheErr
+}
+
+const (
+	DEFAULT_DISK_CACHE_MAX_BYTES = 1 << 30
+	DEFAULT_DISK_CACHE_TTL       = 10 * time.Minute
+
+	DISK_CACHE_GENERATION_BUCKETS = 1024
+)
+
+// NewDiskCache opens the directory, and resumes objects cached by previous processes.
+func NewDiskCache(directory string, maxBytes int64, ttl time.Duration) (*DiskCache, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, logger.ErrorDebug(err)
+	}
+
+	c := &DiskCache{
+		directory: directory,
+		maxBytes:  maxBytes,
+		ttl:       ttl,
+		ll:        list.New(),
+		items:     make(map[string]*list.Element),
+	}
+
+	fileInfos, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, logger.ErrorDebug(err)
+	}
+	sort.Slice(fileInfos, func(i, j int) bool {
+		return fileInfos[i].ModTime().Before(fileInfos[j].ModTime())
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, info := range fileInfos {
+		if strings.HasPrefix(info.Name(), ".tmp-") {
+			os.Remove(c.path(info.Name()))
+			continue
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".metadata") {
+			continue
+		}
+		c.add(info.Name(), info.Size(), info.ModTime())
+	}
+
+	return c, nil
+}
+
+func NewDiskCacheStorage(backend Storage, cache *DiskCache) *DiskCacheStorage {
+	return &DiskCacheStorage{backend: backend, cache: cache}
+}
+
+func (c *DiskCache) path(name string) string {
+	return filepath.Join(c.directory, name)
+}
+
+// add must be called with the lock, files of the name are already replaced when it is cached.
+func (c *DiskCache) add(name string, size int64, fetchedAt time.Time) {
+	if element, ok := c.items[name]; ok {
+		c.detach(element)
+	}
+	c.items[name] = c.ll.PushFront(&diskCacheItem{name: name, size: size, fetchedAt: fetchedAt})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes && c.ll.Len() != 0 {
+		c.remove(c.ll.Back())
+	}
+}
+
+// remove must be called with the lock.
+func (c *DiskCache) remove(element *list.Element) {
+	item := c.detach(element)
+	os.Remove(c.path(item.name))
+	os.Remove(c.path(item.name) + ".metadata")
+}
+
+// detach removes the entry without files, must be called with the lock.
+func (c *DiskCache) detach(element *list.Element) *diskCacheItem {
+	item := element.Value.(*diskCacheItem)
+	c.ll.Remove(element)
+	delete(c.items, item.name)
+	c.bytes -= item.size
+	return item
+}
+
+func generationBucket(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32() % DISK_CACHE_GENERATION_BUCKETS
+}
+
+// generation is taken before fetching the object from the backend, and passed to set.
+func (c *DiskCache) generation(name string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[generationBucket(name)]
+}
+
+func (c *DiskCache) get(name string) (*Object, bool) {
+	c.mu.Lock()
+	element, ok := c.items[name]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	if time.Since(element.Value.(*diskCacheItem).fetchedAt) > c.ttl {
+		c.remove(element)
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.ll.MoveToFront(element)
+	c.mu.Unlock()
+
+	body, err := ioutil.ReadFile(c.path(name))
+	if err != nil {
+		c.invalidate(name)
+		return nil, false
+	}
+	blob, err := ioutil.ReadFile(c.path(name) + ".metadata")
+	if err != nil {
+		c.invalidate(name)
+		return nil, false
+	}
+	metadata := &diskCacheMetadata{}
+	err = json.Unmarshal(blob, metadata)
+	if err != nil {
+		c.invalidate(name)
+		return nil, false
+	}
+
+	return &Object{Body: body, Metadata: metadata.Metadata, Version: metadata.Version, LastModified: metadata.LastModified}, true
+}
+
+// set stores the object fetched at the generation, it is dropped when the name is invalidated after the generation.
+func (c *DiskCache) set(name string, object *Object, generation uint64) error {
+	if int64(len(object.Body)) > c.maxBytes {
+		return nil
+	}
+
+	blob, err := json.Marshal(&diskCacheMetadata{Metadata: object.Metadata, Version: object.Version, LastModified: object.LastModified})
+	if err != nil {
+		return logger.ErrorDebug(err)
+	}
+
+	// write to temporary files and rename, so that readers never see partial files.
+	files := []struct {
+		path    string
+		blob    []byte
+		tmpPath string
+	}{{path: c.path(name) + ".metadata", blob: blob}, {path: c.path(name), blob: object.Body}}
+	defer func() {
+		for _, f := range files {
+			if len(f.tmpPath) != 0 {
+				os.Remove(f.tmpPath)
+			}
+		}
+	}()
+	for i := range files {
+		tmpfile, err := ioutil.TempFile(c.directory, ".tmp-")
+		if err != nil {
+			return logger.ErrorDebug(err)
+		}
+		files[i].tmpPath = tmpfile.Name()
+		_, err = tmpfile.Write(files[i].blob)
+		tmpfile.Close()
+		if err != nil {
+			return logger.ErrorDebug(err)
+		}
+	}
+
+	// renamed with the lock, so that files of concurrent sets and invalidation are not mixed.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[generationBucket(name)] != generation {
+		return nil
+	}
+	for i := range files {
+		err = os.Rename(files[i].tmpPath, files[i].path)
+		if err != nil {
+			return logger.ErrorDebug(err)
+		}
+		files[i].tmpPath = ""
+	}
+	c.add(name, int64(len(object.Body)), time.Now())
+	return nil
+}
+
+func (c *DiskCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[generationBucket(name)]++
+	if element, ok := c.items[name]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *DiskCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// cacheName is a file name of the key in the backend, keys are normalized by BuildKey of the backend,
+// because keys listed by List are already built in some storages.
+func (s *DiskCacheStorage) cacheName(key string) string {
+	if builder, ok := s.backend.(keyBuilder); ok {
+		key = builder.BuildKey(key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *DiskCacheStorage) invalidate(key string) {
+	s.cache.invalidate(s.cacheName(key))
+	// the key may be listed by List, which is already built.
+	sum := sha256.Sum256([]byte(key))
+	s.cache.invalidate(hex.EncodeToString(sum[:]))
+}
+
+func (s *DiskCacheStorage) Open() error {
+	return s.backend.Open()
+}
+
+func (s *DiskCacheStorage) Fetch(ctx context.Context, key string) (*Object, error) {
+	name := s.cacheName(key)
+	if object, ok := s.cache.get(name); ok {
+		logger.WithContext(ctx).WithFields(logrus.Fields{
+			"key": key,
+		}).Debug("found object from disk cache")
+		return object, nil
+	}
+
+	// taken before fetching, so that objects overwritten while they are fetched are not cached.
+	generation := s.cache.generation(name)
+	object, err := s.backend.Fetch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.cache.set(name, object, generation)
+	if err != nil {
+		// the object is still available from the backend.
+		logger.ErrorDebugContext(ctx, err)
+	}
+
+	return object, nil
+}
+
+func (s *DiskCacheStorage) PutFromBlob(ctx context.Context, key string, image []byte, contentType string, metadata map[string]string) error {
+	defer s.invalidate(key)
+	return s.backend.PutFromBlob(ctx, key, image, contentType, metadata)
+}
+
+func (s *DiskCacheStorage) Put(ctx context.Context, key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
+	defer s.invalidate(key)
+	return s.backend.Put(ctx, key, imageFile, contentType, metadata)
+}
+
+func (s *DiskCacheStorage) List(ctx context.Context, key string) ([]StorageItem, error) {
+	return s.backend.List(ctx, key)
+}
+
+func (s *DiskCacheStorage) Move(ctx context.Context, from string, to string) error {
+	defer s.invalidate(to)
+	defer s.invalidate(from)
+	return s.backend.Move(ctx, from, to)
+}
+
+func (s *DiskCacheStorage) Delete(ctx context.Context, key string) error {
+	defer s.invalidate(key)
+	return s.backend.Delete(ctx, key)
+}
+
+func (s *DiskCacheStorage) FetchMetadata(ctx context.Context, key string) (map[string]string, error) {
+	return s.backend.FetchMetadata(ctx, key)
+}
+
+func (s *DiskCacheStorage) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	defer s.invalidate(key)
+	return s.backend.UpdateMetadata(ctx, key, metadata)
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDiskCacheStorage(t *testing.T, maxBytes int64, ttl time.Duration) (*DiskCacheStorage, *FileStorage, func()) {
+	dir, err := ioutil.TempDir("", "kinu-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &FileStorage{baseDirectory: filepath.Join(dir, "storage")}
+	cache, err := NewDiskCache(filepath.Join(dir, "cache"), maxBytes, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewDiskCacheStorage(backend, cache), backend, func() { os.RemoveAll(dir) }
+}
+
+func fetchBody(t *testing.T, s Storage, key string) string {
+	ctx := context.Background()
+	object, err := s.Fetch(ctx, key)
+	if err != nil {
+		t.Fatalf("%s: %s", key, err)
+	}
+	return string(object.Body)
+}
+
+func TestDiskCacheStorageReadThrough(t *testing.T) {
+	ctx := context.Background()
+	s, backend, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	err := s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("first"), "image/jpeg", map[string]string{"Width": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := s.Fetch(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(object.Body) != "first" || object.Metadata["Width"] != "10" || len(object.Version) == 0 {
+		t.Errorf("got %+v", object)
+	}
+
+	// changes of the backend by other processes are not seen until ttl.
+	backend.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("second"), "image/jpeg", map[string]string{})
+	cached, err := s.Fetch(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cached.Body) != "first" || cached.Metadata["Width"] != "10" || cached.Version != object.Version || !cached.LastModified.Equal(object.LastModified) {
+		t.Errorf("got %+v from cache, want %+v", cached, object)
+	}
+
+	// writes through the cache invalidate it.
+	s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("third"), "image/jpeg", map[string]string{})
+	if body := fetchBody(t, s, "foods/1/1.1000.kinu"); body != "third" {
+		t.Errorf("got %s after put", body)
+	}
+
+	err = s.Delete(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fetch(ctx, "foods/1/1.1000.kinu"); err != ErrImageNotFound {
+		t.Errorf("got %v after delete, want ErrImageNotFound", err)
+	}
+}
+
+func TestDiskCacheStorageMove(t *testing.T) {
+	ctx := context.Background()
+	s, _, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	s.PutFromBlob(ctx, "__sandbox__/a/a.1000.kinu", []byte("sandbox"), "image/jpeg", map[string]string{})
+	s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("old"), "image/jpeg", map[string]string{})
+	fetchBody(t, s, "__sandbox__/a/a.1000.kinu")
+	fetchBody(t, s, "foods/1/1.1000.kinu")
+
+	err := s.Move(ctx, "__sandbox__/a/a.1000.kinu", "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := fetchBody(t, s, "foods/1/1.1000.kinu"); body != "sandbox" {
+		t.Errorf("got %s after move", body)
+	}
+	if _, err := s.Fetch(ctx, "__sandbox__/a/a.1000.kinu"); err != ErrImageNotFound {
+		t.Errorf("got %v for moved key, want ErrImageNotFound", err)
+	}
+}
+
+func TestDiskCacheStorageUpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	s, _, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("image"), "image/jpeg", map[string]string{"Width": "10"})
+	object, err := s.Fetch(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := s.FetchMetadata(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata["Rotation"] = "90"
+	err = s.UpdateMetadata(ctx, "foods/1/1.1000.kinu", metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := s.Fetch(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated.Body) != "image" || updated.Metadata["Rotation"] != "90" || updated.Metadata["Width"] != "10" || updated.Metadata["Content-Type"] != "image/jpeg" {
+		t.Errorf("got %+v after metadata is updated", updated)
+	}
+	if updated.Version != object.Version {
+		t.Errorf("got version %s, want %s of the same body", updated.Version, object.Version)
+	}
+
+	if err := s.UpdateMetadata(ctx, "foods/1/missing.1000.kinu", metadata); err != ErrImageNotFound {
+		t.Errorf("got %v for missing key, want ErrImageNotFound", err)
+	}
+}
+
+func TestDiskCacheStorageTTL(t *testing.T) {
+	ctx := context.Background()
+	s, backend, cleanup := newTestDiskCacheStorage(t, 1000, 50*time.Millisecond)
+	defer cleanup()
+
+	backend.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("first"), "image/jpeg", map[string]string{})
+	fetchBody(t, s, "foods/1/1.1000.kinu")
+	backend.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("second"), "image/jpeg", map[string]string{})
+
+	time.Sleep(100 * time.Millisecond)
+	if body := fetchBody(t, s, "foods/1/1.1000.kinu"); body != "second" {
+		t.Errorf("got %s after ttl", body)
+	}
+}
+
+func TestDiskCacheStorageEviction(t *testing.T) {
+	ctx := context.Background()
+	s, backend, cleanup := newTestDiskCacheStorage(t, 25, time.Hour)
+	defer cleanup()
+
+	for _, key := range []string{"foods/1/1.1000.kinu", "foods/2/2.1000.kinu", "foods/3/3.1000.kinu"} {
+		backend.PutFromBlob(ctx, key, bytes.Repeat([]byte("a"), 10), "image/jpeg", map[string]string{})
+	}
+	// too large objects are fetched but not cached.
+	backend.PutFromBlob(ctx, "foods/4/4.1000.kinu", bytes.Repeat([]byte("a"), 30), "image/jpeg", map[string]string{})
+
+	fetchBody(t, s, "foods/1/1.1000.kinu")
+	fetchBody(t, s, "foods/2/2.1000.kinu")
+	fetchBody(t, s, "foods/1/1.1000.kinu")
+	fetchBody(t, s, "foods/3/3.1000.kinu")
+	fetchBody(t, s, "foods/4/4.1000.kinu")
+
+	if bytes := s.cache.Bytes(); bytes != 20 {
+		t.Errorf("cached bytes is %d, want 20", bytes)
+	}
+
+	// cache files are removed on eviction.
+	files, _ := filepath.Glob(filepath.Join(s.cache.directory, "*"))
+	if len(files) != 4 {
+		t.Errorf("got %d cache files, want 4", len(files))
+	}
+
+	// foods/2 is least recently used and evicted.
+	for key, want := range map[string]bool{"foods/1/1.1000.kinu": true, "foods/2/2.1000.kinu": false, "foods/3/3.1000.kinu": true} {
+		if _, cached := s.cache.get(s.cacheName(key)); cached != want {
+			t.Errorf("%s: cached is %v, want %v", key, cached, want)
+		}
+	}
+}
+
+func TestDiskCacheResume(t *testing.T) {
+	ctx := context.Background()
+	s, _, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("first"), "image/jpeg", map[string]string{})
+	fetchBody(t, s, "foods/1/1.1000.kinu")
+
+	cache, err := NewDiskCache(s.cache.directory, 1000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Bytes() != 5 {
+		t.Errorf("resumed bytes is %d, want 5", cache.Bytes())
+	}
+}
+
+func TestDiskCacheSetTwice(t *testing.T) {
+	s, _, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	// concurrent fetches of the same key store the same name one after another.
+	name := s.cacheName("foods/1/1.1000.kinu")
+	for _, body := range []string{"first", "second"} {
+		err := s.cache.set(name, &Object{Body: []byte(body)}, s.cache.generation(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	object, ok := s.cache.get(name)
+	if !ok || string(object.Body) != "second" {
+		t.Errorf("got %+v, %v", object, ok)
+	}
+	if s.cache.Bytes() != 6 {
+		t.Errorf("cached bytes is %d, want 6", s.cache.Bytes())
+	}
+}
+
+func TestDiskCacheSetAfterInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s, backend, cleanup := newTestDiskCacheStorage(t, 1000, time.Hour)
+	defer cleanup()
+
+	// the object is overwritten while the old one is fetched from the backend.
+	backend.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("old"), "image/jpeg", map[string]string{})
+	name := s.cacheName("foods/1/1.1000.kinu")
+	generation := s.cache.generation(name)
+	old, err := backend.Fetch(ctx, "foods/1/1.1000.kinu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PutFromBlob(ctx, "foods/1/1.1000.kinu", []byte("new"), "image/jpeg", map[string]string{})
+
+	err = s.cache.set(name, old, generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := fetchBody(t, s, "foods/1/1.1000.kinu"); body != "new" {
+		t.Errorf("got %s, the old object is cached after put", body)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(s.cache.directory, ".tmp-*"))
+	if len(files) != 0 {
+		t.Errorf("temporary files %v are left", files)
+	}
+}
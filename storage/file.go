@@ -1,12 +1,15 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/tokubai/kinu/logger"
@@ -22,6 +25,7 @@ type FileStorageItem struct {
 	StorageItem
 
 	Name string
+	Info os.FileInfo
 }
 
 func openFileStorage() (Storage, error) {
@@ -50,28 +54,35 @@ func (s *FileStorage) BuildKey(key string) string {
 	return s.baseDirectory + "/" + key
 }
 
-func (s *FileStorage) Fetch(key string) (*Object, error) {
+func (s *FileStorage) Fetch(ctx context.Context, key string) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	key = s.BuildKey(key)
 
-	_, err := os.Stat(key)
+	info, err := os.Stat(key)
 	if err != nil {
 		return nil, ErrImageNotFound
 	}
 
 	fp, err := os.Open(key)
 	if err != nil {
-		return nil, logger.ErrorDebug(err)
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 	defer fp.Close()
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"key": key,
 	}).Debug("found object from file")
 
-	object := &Object{}
+	object := &Object{
+		Version:      strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36),
+		LastModified: info.ModTime(),
+	}
 	object.Body, err = ioutil.ReadAll(fp)
 	if err != nil {
-		return nil, logger.ErrorDebug(err)
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 
 	// Ignore metadata file parse error
@@ -80,40 +91,44 @@ func (s *FileStorage) Fetch(key string) (*Object, error) {
 		decorder := json.NewDecoder(metadataFp)
 		err = decorder.Decode(&object.Metadata)
 		if err != nil {
-			logger.ErrorDebug(err)
+			logger.ErrorDebugContext(ctx, err)
 		}
 	} else {
-		logger.ErrorDebug(err)
+		logger.ErrorDebugContext(ctx, err)
 	}
 	defer metadataFp.Close()
 
 	return object, nil
 }
 
-func (s *FileStorage) PutFromBlob(key string, image []byte, contentType string, metadata map[string]string) error {
+func (s *FileStorage) PutFromBlob(ctx context.Context, key string, image []byte, contentType string, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	key = s.BuildKey(key)
 
 	directory := filepath.Dir(key)
 	err := os.MkdirAll(directory, 0755)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	ioutil.WriteFile(key, image, os.ModePerm)
 
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	metadata["Content-Type"] = contentType
 
 	j, err := json.Marshal(metadata)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 	ioutil.WriteFile(key+".metadata", j, os.ModePerm)
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"directory": directory,
 		"key":       key,
 	}).Debug("put to file")
@@ -121,41 +136,52 @@ func (s *FileStorage) PutFromBlob(key string, image []byte, contentType string,
 	return nil
 }
 
-func (s *FileStorage) Put(key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
+func (s *FileStorage) Put(ctx context.Context, key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
 	image, err := ioutil.ReadAll(imageFile)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
-	return s.PutFromBlob(key, image, contentType, metadata)
+	return s.PutFromBlob(ctx, key, image, contentType, metadata)
 }
 
-func (s *FileStorage) List(key string) ([]StorageItem, error) {
+func (s *FileStorage) List(ctx context.Context, key string) ([]StorageItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key = strings.TrimSuffix(key, "/")
 	path := s.BuildKey(key)
 
 	fileInfos, err := ioutil.ReadDir(path)
-	if err != nil {
-		return nil, logger.ErrorDebug(err)
+	if os.IsNotExist(err) {
+		return nil, ErrImageNotFound
+	} else if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
 	}
 
 	items := make([]StorageItem, 0)
 	for _, info := range fileInfos {
-		logger.WithFields(logrus.Fields{
+		logger.WithContext(ctx).WithFields(logrus.Fields{
 			"path": path,
 			"name": info.Name(),
 			"key":  key,
 		}).Debug("found object")
-		item := FileStorageItem{Name: key + "/" + info.Name()}
+		item := FileStorageItem{Name: key + "/" + info.Name(), Info: info}
 		items = append(items, &item)
 	}
 
 	return items, nil
 }
 
-func (s *FileStorage) Move(from string, to string) error {
+func (s *FileStorage) Move(ctx context.Context, from string, to string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	fromKey := s.BuildKey(from)
 	toKey := s.BuildKey(to)
 
-	logger.WithFields(logrus.Fields{
+	logger.WithContext(ctx).WithFields(logrus.Fields{
 		"from": fromKey,
 		"to":   toKey,
 	}).Debug("move file object start")
@@ -163,23 +189,110 @@ func (s *FileStorage) Move(from string, to string) error {
 	directory := filepath.Dir(fromKey)
 	err := os.MkdirAll(directory, 0755)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	directory = filepath.Dir(toKey)
 	err = os.MkdirAll(directory, 0755)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	err = os.Rename(fromKey, toKey)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	return nil
 }
 
+// Delete removes the file with the metadata file, and the directory when it becomes empty.
+func (s *FileStorage) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key = s.BuildKey(key)
+
+	err := os.Remove(key)
+	if os.IsNotExist(err) {
+		return ErrImageNotFound
+	} else if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	err = os.Remove(key + ".metadata")
+	if err != nil && !os.IsNotExist(err) {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	// fails while other files remain in the directory.
+	os.Remove(filepath.Dir(key))
+
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"key": key,
+	}).Debug("delete file")
+
+	return nil
+}
+
+func (s *FileStorage) FetchMetadata(ctx context.Context, key string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key = s.BuildKey(key)
+
+	_, err := os.Stat(key)
+	if err != nil {
+		return nil, ErrImageNotFound
+	}
+
+	metadata := make(map[string]string)
+	blob, err := ioutil.ReadFile(key + ".metadata")
+	if os.IsNotExist(err) {
+		return metadata, nil
+	} else if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	err = json.Unmarshal(blob, &metadata)
+	if err != nil {
+		return nil, logger.ErrorDebugContext(ctx, err)
+	}
+
+	return metadata, nil
+}
+
+// UpdateMetadata rewrites only the metadata file, so that the version of the image file is not changed.
+func (s *FileStorage) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key = s.BuildKey(key)
+
+	_, err := os.Stat(key)
+	if err != nil {
+		return ErrImageNotFound
+	}
+
+	j, err := json.Marshal(metadata)
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+	err = ioutil.WriteFile(key+".metadata", j, os.ModePerm)
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"key": key,
+	}).Debug("update file metadata")
+
+	return nil
+}
+
 func (s *FileStorageItem) IsValid() bool {
 	if len(s.Extension()) == 0 {
 		return false
@@ -211,3 +324,11 @@ func (s *FileStorageItem) ImageSize() string {
 	path := strings.Split(s.Name, ".")
 	return path[len(path)-2]
 }
+
+func (s *FileStorageItem) Size() int64 {
+	return s.Info.Size()
+}
+
+func (s *FileStorageItem) LastModified() time.Time {
+	return s.Info.ModTime()
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "context"
+
+// CheckReachable lists the key to check the storage is reachable, the key does not need to exist.
+func CheckReachable(ctx context.Context, key string) error {
+	st, err := Open()
+	if err != nil {
+		return err
+	}
+
+	_, err = st.List(ctx, key)
+	if err != nil && err != ErrImageNotFound {
+		return err
+	}
+	return nil
+}
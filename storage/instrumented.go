@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/tokubai/kinu/metrics"
+)
+
+// InstrumentedStorage records fetch time and errors of the backend, ErrImageNotFound is not an error.
+// Errors of canceled operations are replaced with the error of the context, and not recorded.
+type InstrumentedStorage struct {
+	backend     Storage
+	backendName string
+}
+
+func NewInstrumentedStorage(backend Storage, backendName string) *InstrumentedStorage {
+	return &InstrumentedStorage{backend: backend, backendName: backendName}
+}
+
+func (s *InstrumentedStorage) observe(ctx context.Context, operation string, err error) error {
+	if err == nil || err == ErrImageNotFound {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	metrics.StorageErrors.Inc(s.backendName, operation)
+	return err
+}
+
+func (s *InstrumentedStorage) BuildKey(key string) string {
+	if builder, ok := s.backend.(keyBuilder); ok {
+		return builder.BuildKey(key)
+	}
+	return key
+}
+
+func (s *InstrumentedStorage) Open() error {
+	return s.observe(context.Background(), "open", s.backend.Open())
+}
+
+func (s *InstrumentedStorage) Fetch(ctx context.Context, key string) (*Object, error) {
+	defer metrics.ObserveSince(metrics.StorageFetchSeconds, time.Now(), s.backendName)
+	object, err := s.backend.Fetch(ctx, key)
+	return object, s.observe(ctx, "fetch", err)
+}
+
+func (s *InstrumentedStorage) PutFromBlob(ctx context.Context, key string, image []byte, contentType string, metadata map[string]string) error {
+	return s.observe(ctx, "put", s.backend.PutFromBlob(ctx, key, image, contentType, metadata))
+}
+
+func (s *InstrumentedStorage) Put(ctx context.Context, key string, imageFile io.ReadSeeker, contentType string, metadata map[string]string) error {
+	return s.observe(ctx, "put", s.backend.Put(ctx, key, imageFile, contentType, metadata))
+}
+
+func (s *InstrumentedStorage) List(ctx context.Context, key string) ([]StorageItem, error) {
+	items, err := s.backend.List(ctx, key)
+	return items, s.observe(ctx, "list", err)
+}
+
+func (s *InstrumentedStorage) Move(ctx context.Context, from string, to string) error {
+	return s.observe(ctx, "move", s.backend.Move(ctx, from, to))
+}
+
+func (s *InstrumentedStorage) Delete(ctx context.Context, key string) error {
+	return s.observe(ctx, "delete", s.backend.Delete(ctx, key))
+}
+
+func (s *InstrumentedStorage) FetchMetadata(ctx context.Context, key string) (map[string]string, error) {
+	metadata, err := s.backend.FetchMetadata(ctx, key)
+	return metadata, s.observe(ctx, "fetch_metadata", err)
+}
+
+func (s *InstrumentedStorage) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	return s.observe(ctx, "update_metadata", s.backend.UpdateMetadata(ctx, key, metadata))
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awsSession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newTestS3Client returns a client of the server in place of S3.
+func newTestS3Client(t *testing.T, server *httptest.Server) *s3.S3 {
+	session, err := awsSession.NewSession(&aws.Config{
+		Region:           aws.String("ap-northeast-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3.New(session)
+}
+
+// listObjectsServer responds ListObjects of the keys by pages of the size, marked by the last key of the previous page.
+func listObjectsServer(keys []string, pageSize int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := 0
+		if marker := r.URL.Query().Get("marker"); len(marker) != 0 {
+			for i, key := range keys {
+				if key == marker {
+					start = i + 1
+				}
+			}
+		}
+		end := start + pageSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		fmt.Fprintf(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>%t</IsTruncated>`, end < len(keys))
+		for _, key := range keys[start:end] {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>1</Size></Contents>`, key)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	}))
+}
+
+func TestS3StorageListPages(t *testing.T) {
+	keys := []string{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, fmt.Sprintf("images/foods/1/derived.%d.jpg", i))
+	}
+	server := listObjectsServer(keys, 2)
+	defer server.Close()
+
+	storages := map[string]Storage{
+		"S3":                   &S3Storage{client: newTestS3Client(t, server), bucket: "bucket", bucketBasePath: "images"},
+		"BackwardCompatibleS3": &BackwardCompatibleS3Storage{client: newTestS3Client(t, server), bucket: "bucket", bucketBasePath: "images"},
+	}
+	for name, s := range storages {
+		items, err := s.List(context.Background(), "foods/1/")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(items) != len(keys) {
+			t.Fatalf("%s: got %d items, want %d", name, len(items), len(keys))
+		}
+		for i, item := range items {
+			if item.Key() != keys[i] {
+				t.Errorf("%s: got %s, want %s", name, item.Key(), keys[i])
+			}
+		}
+	}
+}
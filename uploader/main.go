@@ -1,6 +1,7 @@
 package uploader
 
 import (
+	"context"
 	"strconv"
 	"sync"
 
@@ -23,14 +24,14 @@ func (e *ErrUpload) Error() string {
 	return messages
 }
 
-func Upload(uploaders []Uploader) error {
+func Upload(ctx context.Context, uploaders []Uploader) error {
 	wg := sync.WaitGroup{}
 	errs := make(chan error, len(uploaders))
 	for _, uploader := range uploaders {
 		wg.Add(1)
 		go func(u Uploader, errs chan error) {
 			defer wg.Done()
-			errs <- u.Exec()
+			errs <- u.Exec(ctx)
 		}(uploader, errs)
 	}
 
@@ -55,7 +56,7 @@ func Upload(uploaders []Uploader) error {
 }
 
 type Uploader interface {
-	Exec() error
+	Exec(ctx context.Context) error
 }
 
 type ImageUploader struct {
@@ -65,6 +66,9 @@ type ImageUploader struct {
 	UploadSize  string
 	ContentType string
 	Ext         string
+
+	// Metadata is stored with Width and Height of the upright image.
+	Metadata map[string]string
 }
 
 func (u *ImageUploader) NeedsResize() bool {
@@ -84,35 +88,47 @@ func (u *ImageUploader) BuildResizeOption() (*resizer.ResizeOption, error) {
 	return &resizer.ResizeOption{Width: size, Height: size}, nil
 }
 
-func (u *ImageUploader) Exec() error {
+func (u *ImageUploader) Exec(ctx context.Context) error {
 	if u.NeedsResize() {
 		resizeOption, err := u.BuildResizeOption()
 		if err != nil {
-			return logger.ErrorDebug(err)
+			return logger.ErrorDebugContext(ctx, err)
 		}
 
-		u.ImageBlob, err = resizer.Run(u.ImageBlob, resizeOption)
+		u.ImageBlob, err = resizer.Run(ctx, u.ImageBlob, resizeOption)
 		if err != nil {
-			return logger.ErrorDebug(err)
+			return logger.ErrorDebugContext(ctx, err)
 		}
 	}
 
 	storage, err := storage.Open()
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	e, err := engine.New(u.ImageBlob)
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
 
 	err = e.Open()
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
+	}
+	defer e.Close()
+
+	// the original is stored as uploaded, its size is of the upright image the same as resized sizes.
+	err = e.AutoOrient()
+	if err != nil {
+		return logger.ErrorDebugContext(ctx, err)
+	}
+
+	metadata := map[string]string{"Width": strconv.Itoa(e.GetImageWidth()), "Height": strconv.Itoa(e.GetImageHeight())}
+	for key, value := range u.Metadata {
+		metadata[key] = value
 	}
 
-	return storage.PutFromBlob(u.Path, u.ImageBlob, u.ContentType, map[string]string{"Width": strconv.Itoa(e.GetImageWidth()), "Height": strconv.Itoa(e.GetImageHeight())})
+	return storage.PutFromBlob(ctx, u.Path, u.ImageBlob, u.ContentType, metadata)
 }
 
 type TextFileUploader struct {
@@ -122,10 +138,10 @@ type TextFileUploader struct {
 	Path string
 }
 
-func (u *TextFileUploader) Exec() error {
+func (u *TextFileUploader) Exec(ctx context.Context) error {
 	storage, err := storage.Open()
 	if err != nil {
-		return logger.ErrorDebug(err)
+		return logger.ErrorDebugContext(ctx, err)
 	}
-	return storage.PutFromBlob(u.Path, []byte(u.Body), "plain/text", map[string]string{})
+	return storage.PutFromBlob(ctx, u.Path, []byte(u.Body), "plain/text", map[string]string{})
 }